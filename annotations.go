@@ -0,0 +1,154 @@
+package dotpgx
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Query execution modes, as set by the "mode" annotation.
+const (
+	ModeExec = "exec" // The query returns no rows
+	ModeOne  = "one"  // The query returns a single row
+	ModeMany = "many" // The query returns any number of rows
+)
+
+// annotations holds the "-- key: value" comments of a query.
+type annotations map[string]string
+
+// annotation returns the key and value of an annotation comment.
+// Keys consist of lower case letters, digits, dashes and underscores.
+// An empty key is returned if text is not an annotation.
+func annotation(text string) (key, value string) {
+	i := strings.IndexByte(text, ':')
+	if i < 1 {
+		return "", ""
+	}
+	key = text[:i]
+	for j, c := range key {
+		if !('a' <= c && c <= 'z') && (j == 0 || !('0' <= c && c <= '9') && c != '-' && c != '_') {
+			return "", ""
+		}
+	}
+	return key, strings.TrimSpace(text[i+1:])
+}
+
+// add an annotation. Values of a repeated key are joined by newlines.
+func (a annotations) add(key, value string) annotations {
+	if a == nil {
+		a = make(annotations)
+	}
+	if v, ok := a[key]; ok {
+		value = strings.Join([]string{v, value}, "\n")
+	}
+	a[key] = value
+	return a
+}
+
+// tags returns the comma or newline separated values of the "tags" annotation.
+func (a annotations) tags() (tags []string) {
+	for _, t := range strings.FieldsFunc(a["tags"], func(r rune) bool { return r == ',' || r == '\n' }) {
+		if t = strings.TrimSpace(t); len(t) > 0 {
+			tags = append(tags, t)
+		}
+	}
+	return
+}
+
+func (a annotations) hasTags(tags []string) bool {
+	have := a.tags()
+	for _, t := range tags {
+		found := false
+		for _, h := range have {
+			if h == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// validate the values of the known annotations.
+func (a annotations) validate() error {
+	for _, key := range []string{"timeout", "slow"} {
+		if v, ok := a[key]; ok {
+			if _, err := time.ParseDuration(v); err != nil {
+				return errors.New(strings.Join([]string{"Invalid " + key + " annotation", err.Error()}, ": "))
+			}
+		}
+	}
+	switch a["mode"] {
+	case "", ModeExec, ModeOne, ModeMany:
+	default:
+		return errors.New(strings.Join([]string{"Invalid mode annotation", a["mode"]}, ": "))
+	}
+	return nil
+}
+
+// QueryInfo describes a parsed query and its annotations.
+type QueryInfo struct {
+	Name string
+	// SQL as it is sent to the database, with named parameters rewritten.
+	SQL string
+	// Params holds the named parameters, in positional order.
+	Params []string
+	// File the query was parsed from, empty if parsed by ParseSQL.
+	File string
+	// Line of the name tag, or the first line of the query if unnamed.
+	Line int
+	// EndLine is the last line of the query.
+	EndLine int
+	// Doc from the "doc" annotation. Multiple doc lines are joined by newlines.
+	Doc string
+	// Timeout from the "timeout" annotation, 0 if not set.
+	Timeout time.Duration
+	// Slow from the "slow" annotation, the threshold of the slow query log.
+	// 0 if not set.
+	Slow time.Duration
+	// Mode from the "mode" annotation: ModeExec, ModeOne, ModeMany or empty.
+	Mode string
+	// Tags from the comma separated "tags" annotation.
+	Tags []string
+	// Route from the "route" annotation, like "primary" or "replica".
+	Route string
+	// Annotations holds all annotations, including the ones above.
+	Annotations map[string]string
+}
+
+func (q *query) info(name string) QueryInfo {
+	// Annotations are validated when parsed, so we can ignore the error.
+	timeout, _ := time.ParseDuration(q.ann["timeout"])
+	slow, _ := time.ParseDuration(q.ann["slow"])
+	qi := QueryInfo{
+		Name:        name,
+		SQL:         q.sql,
+		Params:      append([]string(nil), q.params...),
+		File:        q.start.File,
+		Line:        q.start.Line,
+		EndLine:     q.end.Line,
+		Doc:         q.ann["doc"],
+		Timeout:     timeout,
+		Slow:        slow,
+		Mode:        q.ann["mode"],
+		Tags:        q.ann.tags(),
+		Route:       q.ann["route"],
+		Annotations: make(map[string]string, len(q.ann)),
+	}
+	for k, v := range q.ann {
+		qi.Annotations[k] = v
+	}
+	return qi
+}
+
+// Describe returns the information of the query identified by name.
+func (db *DB) Describe(name string) (QueryInfo, error) {
+	q, err := db.reg.getQuery(name)
+	if err != nil {
+		return QueryInfo{}, err
+	}
+	return q.info(name), nil
+}
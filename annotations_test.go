@@ -0,0 +1,115 @@
+package dotpgx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnnotation(t *testing.T) {
+	tests := []struct {
+		text, key, value string
+	}{
+		{"name: one", "name", "one"},
+		{"timeout:2s", "timeout", "2s"},
+		{"x-route_2: replica ", "x-route_2", "replica"},
+		{"Note: not an annotation", "", ""},
+		{"2fa: not an annotation", "", ""},
+		{"just a comment", "", ""},
+		{": empty key", "", ""},
+	}
+	for _, at := range tests {
+		key, value := annotation(at.text)
+		if key != at.key || value != at.value {
+			t.Errorf("%q Expected: %q %q Got: %q %q", at.text, at.key, at.value, key, value)
+		}
+	}
+}
+
+const annotatedSQL = `
+-- name: report
+-- doc: Counts all peers.
+-- doc: Used by the dashboard.
+-- timeout: 2s
+-- slow: 500ms
+-- mode: one
+-- tags: reporting, slow
+-- route: replica
+select count(*) from peers where email = :email;
+
+-- name: fast
+-- tags: reporting
+select 1;
+
+-- name: plain
+select 2;
+`
+
+func TestDescribe(t *testing.T) {
+	db := new(DB)
+	db.reg.clear()
+	if err := db.ParseSQL(strings.NewReader(annotatedSQL)); err != nil {
+		t.Fatal(err)
+	}
+	exp := QueryInfo{
+		Name:    "report",
+		SQL:     "select count(*) from peers where email = $1;",
+		Params:  []string{"email"},
+		Line:    2,
+		EndLine: 10,
+		Doc:     "Counts all peers.\nUsed by the dashboard.",
+		Timeout: 2 * time.Second,
+		Slow:    500 * time.Millisecond,
+		Mode:    ModeOne,
+		Tags:    []string{"reporting", "slow"},
+		Route:   "replica",
+		Annotations: map[string]string{
+			"doc":     "Counts all peers.\nUsed by the dashboard.",
+			"timeout": "2s",
+			"slow":    "500ms",
+			"mode":    "one",
+			"tags":    "reporting, slow",
+			"route":   "replica",
+		},
+	}
+	got, err := db.Describe("report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatalf("\nExpected:\n%#v\nGot:\n%#v", exp, got)
+	}
+	if _, err = db.Describe("none"); err == nil {
+		t.Error("Expected error for unknown query")
+	}
+
+	lists := []struct {
+		tags []string
+		exp  []string
+	}{
+		{nil, []string{"fast", "plain", "report"}},
+		{[]string{"reporting"}, []string{"fast", "report"}},
+		{[]string{"reporting", "slow"}, []string{"report"}},
+		{[]string{"none"}, nil},
+	}
+	for _, l := range lists {
+		if got := db.List(l.tags...); !reflect.DeepEqual(l.exp, got) {
+			t.Error("List", l.tags, "Expected:", l.exp, "Got:", got)
+		}
+	}
+}
+
+func TestAnnotationErr(t *testing.T) {
+	for _, in := range []string{
+		"-- name: t\n-- timeout: soon\nselect 1;",
+		"-- name: m\n-- mode: all\nselect 1;",
+		"-- name: s\n-- slow: 1 second\nselect 1;",
+	} {
+		db := new(DB)
+		db.reg.clear()
+		if err := db.ParseSQL(strings.NewReader(in)); err == nil {
+			t.Error("Expected an error for", in)
+		}
+	}
+}
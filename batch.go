@@ -12,43 +12,51 @@ import (
 type Batch struct {
 	// Pgx provides direct access to the pgx batch object
 	Pgx *pgx.Batch
-	qm  queryMap
+	reg *registry
+	sql func(ctx context.Context, name string) (string, error)
+
+	hooks  []Hook
+	tx     *Tx
+	queued []string
 }
 
 // BeginBatch starts a new pgx batch.
 func (db *DB) BeginBatch() *Batch {
 	return &Batch{
-		Pgx: db.Pool.BeginBatch(),
-		qm:  db.qm,
+		Pgx:   db.Pool.BeginBatch(),
+		reg:   &db.reg,
+		sql:   db.sql,
+		hooks: db.Hooks,
 	}
 }
 
 // BeginBatch starts a new pgx batch inside the current transaction
 func (tx *Tx) BeginBatch() *Batch {
 	return &Batch{
-		Pgx: tx.Ptx.BeginBatch(),
-		qm:  tx.qm,
+		Pgx:   tx.Ptx.BeginBatch(),
+		reg:   tx.reg,
+		sql:   tx.sql,
+		hooks: tx.hooks,
+		tx:    tx,
 	}
 }
 
 // Queue a query by name
 func (b *Batch) Queue(name string, arguments []interface{}, parameterOIDs []pgtype.OID, resultFormatCodes []int16) (err error) {
-	q, err := b.qm.getQuery(name)
+	sql, err := b.sql(context.Background(), name)
 	if err != nil {
 		return
 	}
-	b.Pgx.Queue(q.getSQL(), arguments, parameterOIDs, resultFormatCodes)
+	b.Pgx.Queue(sql, arguments, parameterOIDs, resultFormatCodes)
+	b.queued = append(b.queued, name)
 	return
 }
 
 // QueueAll the registered queries, sorted by name.
 func (b *Batch) QueueAll() {
-	mutex.Lock()
-	index := b.qm.sort()
-	for _, v := range index {
+	for _, v := range b.reg.queries().sort() {
 		b.Queue(v, nil, nil, nil)
 	}
-	mutex.Unlock()
 }
 
 // Close the batch operation
@@ -58,7 +66,17 @@ func (b *Batch) Close() error {
 
 // Send the batch
 func (b *Batch) Send() error {
-	return b.Pgx.Send(context.TODO(), nil)
+	return b.SendContext(context.Background())
+}
+
+// SendContext sends the batch.
+// The context can be used to cancel the batch while it is in progress.
+// Hooks receive the names of the queued queries in QueryEvent.Queued.
+func (b *Batch) SendContext(ctx context.Context) error {
+	ctx, h := startHooks(ctx, b.hooks, QueryEvent{Op: OpBatch, Queued: b.queued, Tx: b.tx})
+	err := b.Pgx.Send(ctx, nil)
+	h.end(err)
+	return err
 }
 
 // ExecResults reads the results from the next query in the batch as if the query has been sent with Exec.
@@ -1,6 +1,7 @@
 package dotpgx
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -74,3 +75,18 @@ func TestBatch(t *testing.T) {
 	b = tx.BeginBatch()
 	testBatch(b, t)
 }
+
+func TestBatchSendContext(t *testing.T) {
+	b := db.BeginBatch()
+	if err := b.Queue("sleep", []interface{}{10}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	testCancel(t, func(ctx context.Context) error {
+		if err := b.SendContext(ctx); err != nil {
+			return err
+		}
+		_, err := b.ExecResults()
+		return err
+	})
+	b.Close()
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/jackc/pgx/pgtype"
+	"github.com/usrpro/dotpgx"
+)
+
+// queryDesc describes a named query for code generation.
+type queryDesc struct {
+	Name    string // Query name
+	GoName  string // Method name
+	Doc     string
+	Pos     string // Source position
+	Mode    string // One of the dotpgx.Mode* constants
+	Params  []field
+	Columns []field
+}
+
+// field is a parameter or result column.
+type field struct {
+	Name   string // Name in SQL
+	GoName string
+	GoType string
+}
+
+// describe prepares all named queries of db and describes their parameters and columns.
+func describe(db *dotpgx.DB) (descs []queryDesc, err error) {
+	for _, name := range db.List() {
+		if strings.Trim(name, "0123456789") == "" {
+			// Unnamed, auto-numbered query
+			continue
+		}
+		info, err := db.Describe(name)
+		if err != nil {
+			return nil, err
+		}
+		ps, err := db.Prepare(name)
+		if err != nil {
+			return nil, err
+		}
+		d := queryDesc{
+			Name:   name,
+			GoName: exportedName(name),
+			Doc:    info.Doc,
+			Mode:   info.Mode,
+		}
+		if info.File != "" {
+			d.Pos = fmt.Sprintf("%s:%d", info.File, info.Line)
+		}
+		for i, oid := range ps.ParameterOIDs {
+			p := field{Name: fmt.Sprintf("arg%d", i+1)}
+			if i < len(info.Params) {
+				p.Name = info.Params[i]
+			}
+			p.GoName = unexportedName(p.Name)
+			p.GoType = goType(oid, false)
+			d.Params = append(d.Params, p)
+		}
+		for _, fd := range ps.FieldDescriptions {
+			nullable := true
+			if fd.Table != 0 {
+				row := db.Pool.QueryRow(
+					"select attnotnull from pg_attribute where attrelid = $1 and attnum = $2",
+					fd.Table, int16(fd.AttributeNumber),
+				)
+				var notNull bool
+				if err := row.Scan(&notNull); err != nil {
+					return nil, err
+				}
+				nullable = !notNull
+			}
+			d.Columns = append(d.Columns, field{
+				Name:   fd.Name,
+				GoName: exportedName(fd.Name),
+				GoType: goType(fd.DataType, nullable),
+			})
+		}
+		descs = append(descs, d)
+	}
+	return descs, nil
+}
+
+// goTypes maps PostgreSQL type OIDs to Go types.
+var goTypes = map[pgtype.OID]string{
+	pgtype.BoolOID:             "bool",
+	pgtype.Int2OID:             "int16",
+	pgtype.Int4OID:             "int32",
+	pgtype.Int8OID:             "int64",
+	pgtype.OIDOID:              "pgtype.OID",
+	pgtype.Float4OID:           "float32",
+	pgtype.Float8OID:           "float64",
+	pgtype.TextOID:             "string",
+	pgtype.VarcharOID:          "string",
+	pgtype.BPCharOID:           "string",
+	pgtype.NameOID:             "string",
+	pgtype.ByteaOID:            "[]byte",
+	pgtype.JSONOID:             "[]byte",
+	pgtype.JSONBOID:            "[]byte",
+	pgtype.DateOID:             "time.Time",
+	pgtype.TimestampOID:        "time.Time",
+	pgtype.TimestamptzOID:      "time.Time",
+	pgtype.NumericOID:          "pgtype.Numeric",
+	pgtype.UUIDOID:             "pgtype.UUID",
+	pgtype.InetOID:             "pgtype.Inet",
+	pgtype.BoolArrayOID:        "[]bool",
+	pgtype.Int2ArrayOID:        "[]int16",
+	pgtype.Int4ArrayOID:        "[]int32",
+	pgtype.Int8ArrayOID:        "[]int64",
+	pgtype.Float4ArrayOID:      "[]float32",
+	pgtype.Float8ArrayOID:      "[]float64",
+	pgtype.TextArrayOID:        "[]string",
+	pgtype.VarcharArrayOID:     "[]string",
+	pgtype.TimestamptzArrayOID: "[]time.Time",
+}
+
+// goType returns the Go type for a PostgreSQL type OID.
+// Nullable types become pointers, unless they are slices or pgtype values,
+// which handle NULL themselves. Unknown types are scanned as text.
+func goType(oid pgtype.OID, nullable bool) string {
+	t, ok := goTypes[oid]
+	if !ok {
+		if nullable {
+			return "pgtype.GenericText"
+		}
+		return "interface{}"
+	}
+	if nullable && !strings.HasPrefix(t, "[]") && !strings.HasPrefix(t, "pgtype.") {
+		return "*" + t
+	}
+	return t
+}
+
+// initialisms are written in upper case in Go names.
+var initialisms = map[string]bool{
+	"api": true, "db": true, "html": true, "http": true, "id": true, "ip": true,
+	"json": true, "sql": true, "uri": true, "url": true, "uuid": true,
+}
+
+// words splits names like "find-peers-by-email" or "user_id" into words.
+func words(name string) []string {
+	return strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// exportedName converts a query or column name into an exported Go name.
+func exportedName(name string) string {
+	var b strings.Builder
+	for _, w := range words(name) {
+		w = strings.ToLower(w)
+		if initialisms[w] {
+			b.WriteString(strings.ToUpper(w))
+		} else {
+			r := []rune(w)
+			b.WriteRune(unicode.ToUpper(r[0]))
+			b.WriteString(string(r[1:]))
+		}
+	}
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "Q" + s
+	}
+	return s
+}
+
+// reserved are the names used by the generated methods, other than the parameters.
+var reserved = map[string]bool{
+	"ctx": true, "q": true, "r": true, "row": true, "rows": true, "rs": true, "err": true,
+}
+
+// unexportedName converts a parameter name into an unexported Go name.
+// Names that do not start with a letter are prefixed by "arg".
+func unexportedName(name string) string {
+	ws := words(name)
+	if len(ws) == 0 {
+		return "arg"
+	}
+	s := strings.ToLower(ws[0])
+	if len(ws) > 1 {
+		s += exportedName(strings.Join(ws[1:], "_"))
+	}
+	if !unicode.IsLetter([]rune(s)[0]) {
+		s = "arg" + s
+	}
+	if token.IsKeyword(s) || reserved[s] {
+		s += "_"
+	}
+	return s
+}
+
+const fileTemplate = `// Code generated by dotpgx-gen. DO NOT EDIT.
+
+package {{.Pkg}}
+
+import (
+{{range .Std}}	"{{.}}"
+{{end}}
+{{range .Ext}}	"{{.}}"
+{{end}})
+
+// Querier runs named queries. It is a subset of dotpgx.Querier,
+// implemented by *dotpgx.DB and *dotpgx.Tx.
+type Querier interface {
+	QueryContext(ctx context.Context, name string, args ...interface{}) (*pgx.Rows, error)
+	QueryRowContext(ctx context.Context, name string, args ...interface{}) (*pgx.Row, error)
+	ExecContext(ctx context.Context, name string, args ...interface{}) (pgx.CommandTag, error)
+}
+
+// Queries provides a typed method for each named query.
+type Queries struct {
+	q Querier
+}
+
+// New returns Queries which run on q.
+func New(q Querier) *Queries {
+	return &Queries{q: q}
+}
+{{range .Queries}}{{$q := .}}
+{{if ne .Mode "exec"}}// {{.GoName}}Row is a result row of the {{.Name}} query.
+type {{.GoName}}Row struct {
+{{range .Columns}}	{{.GoName}} {{.GoType}} ` + "`" + `db:"{{.Name}}"` + "`" + `
+{{end}}}
+{{end}}
+// {{.GoName}} runs the {{.Name}} query{{if .Pos}}, defined at {{.Pos}}{{end}}.
+{{comment .Doc}}func (q *Queries) {{.GoName}}(ctx context.Context{{range .Params}}, {{.GoName}} {{.GoType}}{{end}}) {{if eq .Mode "exec"}}(pgx.CommandTag, error) {
+	return q.q.ExecContext(ctx, "{{.Name}}"{{template "args" .}})
+}
+{{else if eq .Mode "one"}}({{.GoName}}Row, error) {
+	var r {{.GoName}}Row
+	row, err := q.q.QueryRowContext(ctx, "{{.Name}}"{{template "args" .}})
+	if err != nil {
+		return r, err
+	}
+	err = row.Scan({{template "dest" .}})
+	return r, err
+}
+{{else}}([]{{.GoName}}Row, error) {
+	rows, err := q.q.QueryContext(ctx, "{{.Name}}"{{template "args" .}})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rs []{{.GoName}}Row
+	for rows.Next() {
+		var r {{.GoName}}Row
+		if err := rows.Scan({{template "dest" .}}); err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
+{{end}}{{end}}
+{{define "args"}}{{range .Params}}, {{.GoName}}{{end}}{{end}}
+{{define "dest"}}{{range $i, $c := .Columns}}{{if $i}}, {{end}}&r.{{$c.GoName}}{{end}}{{end}}`
+
+var tmpl = template.Must(template.New("file").Funcs(template.FuncMap{
+	"comment": func(doc string) string {
+		if doc == "" {
+			return ""
+		}
+		var b strings.Builder
+		b.WriteString("//\n")
+		for _, l := range strings.Split(doc, "\n") {
+			b.WriteString("// " + l + "\n")
+		}
+		return b.String()
+	},
+}).Parse(fileTemplate))
+
+// generate returns the formatted Go source for the described queries.
+func generate(pkg string, descs []queryDesc) ([]byte, error) {
+	std := map[string]bool{"context": true}
+	ext := map[string]bool{"github.com/jackc/pgx": true}
+	for i := range descs {
+		d := &descs[i]
+		if d.Mode == "" || len(d.Columns) == 0 {
+			d.Mode = dotpgx.ModeMany
+			if len(d.Columns) == 0 {
+				d.Mode = dotpgx.ModeExec
+			}
+		}
+		dedup(d.Params)
+		dedup(d.Columns)
+		for _, f := range append(d.Params, d.Columns...) {
+			if strings.Contains(f.GoType, "time.") {
+				std["time"] = true
+			}
+			if strings.Contains(f.GoType, "pgtype.") {
+				ext["github.com/jackc/pgx/pgtype"] = true
+			}
+		}
+	}
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, struct {
+		Pkg      string
+		Std, Ext []string
+		Queries  []queryDesc
+	}{pkg, keys(std), keys(ext), descs})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// dedup makes the Go names of parameters or columns unique by appending a number.
+func dedup(cols []field) {
+	seen := make(map[string]int)
+	for i, c := range cols {
+		if n := seen[c.GoName]; n > 0 {
+			cols[i].GoName = fmt.Sprintf("%s%d", c.GoName, n+1)
+		}
+		seen[c.GoName]++
+	}
+}
+
+func keys(m map[string]bool) (k []string) {
+	for s := range m {
+		k = append(k, s)
+	}
+	sort.Strings(k)
+	return
+}
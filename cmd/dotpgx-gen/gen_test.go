@@ -0,0 +1,159 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/pgtype"
+)
+
+func TestNames(t *testing.T) {
+	exported := map[string]string{
+		"find-peers-by-email": "FindPeersByEmail",
+		"user_id":             "UserID",
+		"json-api_url":        "JSONAPIURL",
+		"count":               "Count",
+		"2fa":                 "Q2fa",
+	}
+	for in, exp := range exported {
+		if got := exportedName(in); got != exp {
+			t.Error("exportedName", in, "Expected:", exp, "Got:", got)
+		}
+	}
+	unexported := map[string]string{
+		"email":   "email",
+		"user_id": "userID",
+		"type":    "type_",
+		"ctx":     "ctx_",
+		"1":       "arg1",
+		"2fa":     "arg2fa",
+		"row":     "row_",
+		"rs":      "rs_",
+	}
+	for in, exp := range unexported {
+		if got := unexportedName(in); got != exp {
+			t.Error("unexportedName", in, "Expected:", exp, "Got:", got)
+		}
+	}
+}
+
+func TestGoType(t *testing.T) {
+	tests := []struct {
+		oid      pgtype.OID
+		nullable bool
+		exp      string
+	}{
+		{pgtype.TextOID, false, "string"},
+		{pgtype.TextOID, true, "*string"},
+		{pgtype.TimestamptzOID, true, "*time.Time"},
+		{pgtype.Int4ArrayOID, true, "[]int32"},
+		{pgtype.NumericOID, true, "pgtype.Numeric"},
+		{2278, true, "pgtype.GenericText"},
+		{2278, false, "interface{}"},
+	}
+	for _, gt := range tests {
+		if got := goType(gt.oid, gt.nullable); got != gt.exp {
+			t.Error(gt.oid, gt.nullable, "Expected:", gt.exp, "Got:", got)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	descs := []queryDesc{
+		{
+			Name:   "create-peer",
+			GoName: "CreatePeer",
+			Params: []field{{"name", "name", "string"}, {"email", "email", "string"}},
+		},
+		{
+			Name:   "find-peers-by-email",
+			GoName: "FindPeersByEmail",
+			Doc:    "Finds all peers\nwith an email address.",
+			Pos:    "queries.sql:4",
+			Params: []field{{"email", "email", "string"}},
+			Columns: []field{
+				{"name", "Name", "*string"},
+				{"email", "Email", "string"},
+				{"email", "Email", "string"},
+			},
+		},
+		{
+			Name:    "find-one-peer-by-email",
+			GoName:  "FindOnePeerByEmail",
+			Mode:    "one",
+			Params:  []field{{"email", "email", "string"}},
+			Columns: []field{{"created", "Created", "time.Time"}},
+		},
+	}
+	src, err := generate("queries", descs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(src)
+	for _, exp := range []string{
+		"package queries\n",
+		"\t\"time\"\n",
+		"func (q *Queries) CreatePeer(ctx context.Context, name string, email string) (pgx.CommandTag, error) {",
+		"return q.q.ExecContext(ctx, \"create-peer\", name, email)",
+		"// FindPeersByEmail runs the find-peers-by-email query, defined at queries.sql:4.\n//\n// Finds all peers\n// with an email address.\n",
+		"func (q *Queries) FindPeersByEmail(ctx context.Context, email string) ([]FindPeersByEmailRow, error) {",
+		"Email2 string  `db:\"email\"`",
+		"rows.Scan(&r.Name, &r.Email, &r.Email2)",
+		"func (q *Queries) FindOnePeerByEmail(ctx context.Context, email string) (FindOnePeerByEmailRow, error) {",
+		"err = row.Scan(&r.Created)",
+	} {
+		if !strings.Contains(got, exp) {
+			t.Errorf("Generated source does not contain:\n%s\nGot:\n%s", exp, got)
+		}
+	}
+}
+
+// fakeImporter returns empty packages, so that only errors
+// that do not involve imported declarations are reported.
+type fakeImporter struct{}
+
+func (fakeImporter) Import(path string) (*types.Package, error) {
+	pkg := types.NewPackage(path, path[strings.LastIndexByte(path, '/')+1:])
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+func TestGenerateCompiles(t *testing.T) {
+	params := func(names ...string) (fs []field) {
+		for _, n := range names {
+			fs = append(fs, field{n, unexportedName(n), "int32"})
+		}
+		return
+	}
+	cols := []field{{"id", "ID", "int32"}}
+	descs := []queryDesc{
+		{Name: "exec", GoName: "Exec", Params: params("1", "2", "ctx", "q", "err")},
+		{Name: "one", GoName: "One", Mode: "one", Params: params("r", "row", "err"), Columns: cols},
+		{Name: "many", GoName: "Many", Params: params("r", "rs", "rows", "user_id", "user-id"), Columns: cols},
+	}
+	src, err := generate("queries", descs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "queries.go", src, 0)
+	if err != nil {
+		t.Fatal(err, "\n", string(src))
+	}
+	conf := types.Config{
+		Importer: fakeImporter{},
+		Error: func(err error) {
+			if msg := err.(types.Error).Msg; !strings.HasPrefix(msg, "undefined: ") {
+				t.Error(err)
+			}
+		},
+	}
+	conf.Check("queries", fset, []*ast.File{f}, nil)
+	if t.Failed() {
+		t.Log(string(src))
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Dotpgx-gen generates typed Go methods for the named queries in .sql files.
+
+The queries are parsed with dotpgx and prepared on a PostgreSQL database,
+which reports the types of the parameters and result columns.
+The generated file contains a Queries type with one method per named query,
+which runs on a *dotpgx.DB or *dotpgx.Tx:
+
+	q := queries.New(db)
+	peers, err := q.FindPeersByEmail(ctx, "foo@bar.com")
+
+The "mode" annotation of a query determines the return type of its method:
+"exec" returns the command tag, "one" a single row and "many" a slice of rows.
+Without annotation, queries returning columns are "many" and others "exec".
+The "doc" annotation is used as the doc comment of the method.
+Unnamed queries are skipped.
+
+Usage:
+
+	dotpgx-gen -path sql -pkg queries -out queries/queries.go -db mydb
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/usrpro/dotpgx"
+)
+
+func main() {
+	c := dotpgx.Default
+	path := flag.String("path", "sql", "Directory with .sql files")
+	pkg := flag.String("pkg", "queries", "Package name of the generated file")
+	out := flag.String("out", "queries.go", "Output file, - for stdout")
+	flag.StringVar(&c.Name, "db", c.Name, "PostgreSQL database name")
+	flag.StringVar(&c.Host, "host", c.Host, "PostgreSQL host")
+	flag.UintVar(&c.Port, "port", c.Port, "PostgreSQL port number")
+	flag.StringVar(&c.User, "user", c.User, "PostgreSQL username")
+	flag.StringVar(&c.Password, "password", c.Password, "PostgreSQL password")
+	flag.Parse()
+
+	if err := run(c, *path, *pkg, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "dotpgx-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(c dotpgx.Config, path, pkg, out string) error {
+	db, err := dotpgx.InitDB(c, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	descs, err := describe(db)
+	if err != nil {
+		return err
+	}
+	src, err := generate(pkg, descs)
+	if err != nil {
+		return err
+	}
+	if out == "-" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
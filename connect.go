@@ -2,8 +2,8 @@ package dotpgx
 
 import (
 	"crypto/tls"
+	"io/fs"
 
-	"github.com/inconshreveable/log15"
 	"github.com/jackc/pgx"
 )
 
@@ -11,7 +11,8 @@ type dbRuntime struct {
 	AppName string `usage:"Application name reported to PostgreSQL"`
 }
 
-// Config for database
+// Config for database.
+// It can be loaded from the environment, a DSN and flags, see LoadConfig.
 type Config struct {
 	Name           string `usage:"PostgreSQL database name"`
 	Host           string `usage:"PostgreSQL host"`
@@ -74,6 +75,20 @@ func InitDB(c Config, path string) (db *DB, err error) {
 	if err = db.ParsePath(path); err != nil {
 		return
 	}
-	log15.Debug("Loaded sql", "queries", db.List())
+	db.log().Debug("Loaded sql", "queries", db.List())
+	return
+}
+
+// InitDBFS is a wrapper for New() and ParseFS().
+// Config is the dotpgx config, which will be parsed into a pgx.ConnPoolConfig.
+// Queries are parsed from the files in fsys matching patterns, typically an embed.FS.
+func InitDBFS(c Config, fsys fs.FS, patterns ...string) (db *DB, err error) {
+	if db, err = New(c.ConnPoolConfig()); err != nil {
+		return
+	}
+	if err = db.ParseFS(fsys, patterns...); err != nil {
+		return
+	}
+	db.log().Debug("Loaded sql", "queries", db.List())
 	return
 }
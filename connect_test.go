@@ -1,9 +1,11 @@
 package dotpgx
 
 import (
+	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/jackc/pgx"
 )
@@ -74,3 +76,26 @@ func TestInitDB(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestInitDBFS(t *testing.T) {
+	exp := "no such host"
+	_, err := InitDBFS(testConfig, os.DirFS("tests"))
+	if err == nil || !strings.HasSuffix(err.Error(), exp) {
+		t.Error("Expected error", exp, "Got:", err)
+	}
+
+	exp = "No files to parse"
+	_, err = InitDBFS(Default, fstest.MapFS{})
+	if err == nil || err.Error() != exp {
+		t.Error("Expected error", exp, "Got:", err)
+	}
+
+	db, err := InitDBFS(Default, os.DirFS("tests"), "queries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !db.HasQueries() {
+		t.Error("No queries loaded")
+	}
+}
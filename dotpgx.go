@@ -2,23 +2,49 @@
 package dotpgx
 
 import (
-	"errors"
-	"fmt"
-	"strings"
+	"context"
+	"time"
 
 	"github.com/jackc/pgx"
-	"github.com/jackc/pgx/log/log15adapter"
-	log "gopkg.in/inconshreveable/log15.v2"
 )
 
 // DB represents the database connection pool and parsed queries.
 type DB struct {
 	// Pool allows direct access to the underlying *pgx.ConnPool
 	Pool *pgx.ConnPool
-	qm   queryMap
-	qn   int // Incremented value for unamed queries
+	reg  registry
+	// Duplicates determines how the parser handles query names
+	// that are already defined. It defaults to DuplicateStrict.
+	Duplicates DuplicateMode
+	// WatchInterval is the polling interval of Watch.
+	// It defaults to DefaultWatchInterval.
+	WatchInterval time.Duration
+	// OnWatchError receives the errors of reloading changed files by Watch.
+	// If nil, the errors are logged.
+	OnWatchError func(error)
+	// PrepareMode determines when queries get prepared.
+	// It defaults to PrepareNone.
+	PrepareMode PrepareMode
+	// Hooks are called around every operation on the DB and its transactions and batches.
+	// BeforeQuery is called in order, AfterQuery in reverse order.
+	// Hooks must be set before the DB is used.
+	Hooks []Hook
+	// Logger receives the records of the pool, parsing, prepare and deallocate failures.
+	// It defaults to the slog default logger. See NewWithLogger to set it
+	// before the pool is created.
+	Logger Logger
 }
 
+// DuplicateMode determines how duplicate query names are handled by the parser.
+type DuplicateMode int
+
+const (
+	// DuplicateStrict makes parsing fail with a *DuplicateError.
+	DuplicateStrict DuplicateMode = iota
+	// DuplicateOverride replaces the existing query with the one parsed last.
+	DuplicateOverride
+)
+
 /*
 New configures and creates a database connection pool
 It returns a pointer to the Database object.
@@ -37,101 +63,159 @@ An example config object would look like:
 		AfterConnect:   sqlPrepare,
 	}
 
-Most arguments are optional. If no logger is specified,
-one will get apointed automatically.
+Most arguments are optional. If no pgx logger is specified,
+pgx logs to the Logger of the DB.
 */
-func New(conf pgx.ConnPoolConfig) (db *DB, err error) {
+func New(conf pgx.ConnPoolConfig) (*DB, error) {
+	return NewWithLogger(conf, nil)
+}
+
+// NewWithLogger is like New, with logger as the Logger of the DB.
+// A nil logger uses the slog default logger.
+func NewWithLogger(conf pgx.ConnPoolConfig, logger Logger) (*DB, error) {
+	db := &DB{Logger: logger}
 	if conf.Logger == nil {
-		conf.Logger = log15adapter.NewLogger(log.New("module", "pgx"))
+		conf.Logger = pgxLogger{db}
 	}
 	pool, err := pgx.NewConnPool(conf)
 	if err != nil {
-		log.Crit("Unable to create connection pool", "error", err)
-		return
-	}
-	db = &DB{
-		Pool: pool,
-		qm:   make(queryMap),
+		db.log().Error("Unable to create connection pool", "error", err)
+		return nil, err
 	}
-	return
+	db.Pool = pool
+	return db, nil
 }
 
 // HasQueries returns true if the are queries in the map.
 // False in case of nil map or 0 queries.
 func (db *DB) HasQueries() bool {
-	return db.qm != nil && len(db.qm) > 0
+	return len(db.reg.queries()) > 0
 }
 
-// List of all registered query names, sorted
-func (db *DB) List() (index []string) {
-	return db.qm.sort()
+// List of all registered query names, sorted.
+// If tags are given, only the queries annotated with all of these tags are listed.
+func (db *DB) List(tags ...string) (index []string) {
+	qm := db.reg.queries()
+	for _, name := range qm.sort() {
+		if qm[name].ann.hasTags(tags) {
+			index = append(index, name)
+		}
+	}
+	return
 }
 
 // Prepare a sql statement identified by name.
 func (db *DB) Prepare(name string) (*pgx.PreparedStatement, error) {
-	q, err := db.qm.getQuery(name)
+	return db.PrepareContext(context.Background(), name)
+}
+
+// PrepareContext prepares a sql statement identified by name,
+// on all connections of the pool.
+// The context can be used to cancel the prepare operation.
+func (db *DB) PrepareContext(ctx context.Context, name string) (*pgx.PreparedStatement, error) {
+	db.reg.stmts.RLock()
+	defer db.reg.stmts.RUnlock()
+	q, err := db.reg.getQuery(name)
 	if err != nil {
 		return nil, err
 	}
-	q.ps, err = db.Pool.Prepare(name, q.sql)
+	ctx, h := db.hook(ctx, OpPrepare, name, nil)
+	ps, err := db.Pool.PrepareEx(ctx, name, q.sql, nil)
 	if err != nil {
+		err = q.wrap(name, err)
+		db.log().Error("Prepare failed", "query", name, "error", err)
+		h.end(err)
 		return nil, err
 	}
-	return q.ps, nil
+	h.end(nil)
+	db.reg.setPrepared(q, ps)
+	return ps, nil
 }
 
 // PrepareAll prepares all registered queries. It returns an error
 // when one of the queries failed to prepare. However, it will not
 // abort in such case and attempts to prepare the remaining statements.
+// The error is a MultiError, holding an error for each failed query
+// that mentions its source position.
 func (db *DB) PrepareAll() (ps []*pgx.PreparedStatement, err error) {
-	msg := []string{}
-	for name, query := range db.qm {
-		p, e := db.Prepare(name)
+	return db.PrepareAllContext(context.Background())
+}
+
+// PrepareAllContext is like PrepareAll, but each prepare operation
+// can be cancelled through the context.
+func (db *DB) PrepareAllContext(ctx context.Context) (ps []*pgx.PreparedStatement, err error) {
+	var errs MultiError
+	for name, query := range db.reg.queries() {
+		p, e := db.PrepareContext(ctx, name)
 		if e != nil {
-			m := []string{
-				"Error in preparing statement:",
-				name,
-				"; With query:",
-				query.sql,
-			}
-			msg = append(msg, strings.Join(m, " "))
+			errs = append(errs, prepareError(name, query, e))
 		} else {
 			ps = append(ps, p)
 		}
 	}
-	if len(msg) > 0 {
-		err = errors.New(strings.Join(msg, "\n"))
-	}
-	return
+	return ps, errs.err()
 }
 
 // Query runs the sql indentified by name. Return a row set.
 func (db *DB) Query(name string, args ...interface{}) (*pgx.Rows, error) {
-	q, err := db.qm.getQuery(name)
+	return db.QueryContext(context.Background(), name, args...)
+}
+
+// QueryContext runs the sql indentified by name. Return a row set.
+// The query is cancelled when the context is done.
+// Errors reported by PostgreSQL are wrapped in a *QueryError.
+func (db *DB) QueryContext(ctx context.Context, name string, args ...interface{}) (*pgx.Rows, error) {
+	sql, err := db.sql(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	return db.Pool.Query(q.getSQL(), args...)
+	ctx, h := db.hook(ctx, OpQuery, name, args)
+	rows, err := db.Pool.QueryEx(ctx, sql, nil, args...)
+	err = db.reg.wrap(name, err)
+	h.end(err)
+	return rows, err
 }
 
 // QueryRow runs the sql identified by name. It returns a single row.
 // Not that an error is only returned if the query is not defined.
 // A query error is defered untill row.Scan is run. See pgx docs for more info.
 func (db *DB) QueryRow(name string, args ...interface{}) (*pgx.Row, error) {
-	q, err := db.qm.getQuery(name)
+	return db.QueryRowContext(context.Background(), name, args...)
+}
+
+// QueryRowContext runs the sql identified by name. It returns a single row.
+// The query is cancelled when the context is done,
+// in which case the error is reported by row.Scan.
+// Hooks only receive the errors of sending the query, see Hook.
+func (db *DB) QueryRowContext(ctx context.Context, name string, args ...interface{}) (*pgx.Row, error) {
+	sql, err := db.sql(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	return db.Pool.QueryRow(q.getSQL(), args...), nil
+	ctx, h := db.hook(ctx, OpQueryRow, name, args)
+	row := db.Pool.QueryRowEx(ctx, sql, nil, args...)
+	h.end(db.reg.wrap(name, (*pgx.Rows)(row).Err()))
+	return row, nil
 }
 
 // Exec runs the sql identified by name. Returns the result of the exec or an error.
 func (db *DB) Exec(name string, args ...interface{}) (pgx.CommandTag, error) {
-	q, err := db.qm.getQuery(name)
+	return db.ExecContext(context.Background(), name, args...)
+}
+
+// ExecContext runs the sql identified by name. Returns the result of the exec or an error.
+// The query is cancelled when the context is done.
+// Errors reported by PostgreSQL are wrapped in a *QueryError.
+func (db *DB) ExecContext(ctx context.Context, name string, args ...interface{}) (pgx.CommandTag, error) {
+	sql, err := db.sql(ctx, name)
 	if err != nil {
 		return "", err
 	}
-	return db.Pool.Exec(q.getSQL(), args...)
+	ctx, h := db.hook(ctx, OpExec, name, args)
+	tag, err := db.Pool.ExecEx(ctx, sql, nil, args...)
+	err = db.reg.wrap(name, err)
+	h.endExec(tag, err)
+	return tag, err
 }
 
 // DropQuery removes a query form the Map.
@@ -139,32 +223,42 @@ func (db *DB) Exec(name string, args ...interface{}) (pgx.CommandTag, error) {
 // An error is returned only when deallocating fails.
 // Regardless of an error, the query will be dropped from the map.
 func (db *DB) DropQuery(name string) (err error) {
-	if db.qm[name].isPrepared() {
-		err = db.Pool.Deallocate(name)
+	db.reg.stmts.Lock()
+	defer db.reg.stmts.Unlock()
+	if q := db.reg.drop(name); db.reg.prepared(q) {
+		if err = db.Pool.Deallocate(name); err != nil {
+			db.log().Error("Deallocate failed", "query", name, "error", err)
+		}
 	}
-	mutex.Lock()
-	delete(db.qm, name)
-	mutex.Unlock()
 	return
 }
 
 // ClearMap clears the query map and sets the internal incremental counter to 0.
 // Use this before you want to load a fresh set of queries, keeping the connection pool open.
-// An error is only returned if one or more prepared statements failed to deallocate.
+// An error is only returned if one or more prepared statements failed to deallocate,
+// as a MultiError holding each failure.
 // It does not abbort on error and continues to (attempt) the clear the remaining queries.
-func (db *DB) ClearMap() (err error) {
-	var msg []string
-	for name := range db.qm {
-		err := db.DropQuery(name)
-		if err != nil {
-			msg = append(msg, fmt.Sprint(err))
+func (db *DB) ClearMap() error {
+	db.reg.stmts.Lock()
+	defer db.reg.stmts.Unlock()
+	return db.deallocate(db.reg.clear())
+}
+
+// deallocate the prepared statements of the queries in qm,
+// which must no longer be in the registry.
+// It attempts all queries, the MultiError holds each failure.
+func (db *DB) deallocate(qm queryMap) error {
+	var errs MultiError
+	for name, q := range qm {
+		if !db.reg.prepared(q) {
+			continue
+		}
+		if err := db.Pool.Deallocate(name); err != nil {
+			db.log().Error("Deallocate failed", "query", name, "error", err)
+			errs = append(errs, err)
 		}
 	}
-	db.qn = 0
-	if len(msg) > 0 {
-		err = errors.New(strings.Join(msg, "\n"))
-	}
-	return
+	return errs.err()
 }
 
 // Close cleans up the mapped queries and closes the pgx connection pool.
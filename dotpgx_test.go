@@ -1,11 +1,13 @@
 package dotpgx
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx"
 )
@@ -75,8 +77,10 @@ func TestMain(m *testing.M) {
 		if err != nil {
 			panic(err)
 		}
-		fmt.Println(db.qm)
-		if db.qm["drop-peers-table"] == nil {
+		// Tests re-parse the queries to reset prepared statements
+		db.Duplicates = DuplicateOverride
+		fmt.Println(db.reg.queries())
+		if db.reg.queries()["drop-peers-table"] == nil {
 			panic("Cleanup query not loaded, aborting")
 		}
 		defer clean()
@@ -122,8 +126,8 @@ func TestNewHasListClearClose(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(cp.qm) > 0 && cp.qn != 0 {
-		t.Fatal("Failed to clear the query map:", cp.qm, cp.qn)
+	if len(cp.reg.queries()) > 0 && cp.reg.qn != 0 {
+		t.Fatal("Failed to clear the query map:", cp.reg.queries(), cp.reg.qn)
 	}
 	// See of we can parse again
 	err = cp.ParsePath(queriesDir)
@@ -176,6 +180,48 @@ func TestExec(t *testing.T) {
 	}
 }
 
+// testCancel runs a long pg_sleep through f with a short deadline.
+// It expects f to return early with the context's error.
+func testCancel(t *testing.T, f func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := f(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatal("Expected error", context.DeadlineExceeded, "Got:", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatal("Query not cancelled in time, took", d)
+	}
+}
+
+func TestQueryContext(t *testing.T) {
+	testCancel(t, func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, "sleep", 10)
+		return err
+	})
+	testCancel(t, func(ctx context.Context) error {
+		rows, err := db.QueryContext(ctx, "sleep", 10)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		return rows.Err()
+	})
+	testCancel(t, func(ctx context.Context) error {
+		row, err := db.QueryRowContext(ctx, "sleep", 10)
+		if err != nil {
+			return err
+		}
+		return row.Scan(nil)
+	})
+	if _, err := db.ExecContext(context.Background(), "none"); err == nil {
+		t.Fatal("Expected error for unknown query")
+	}
+}
+
 func TestPrepare(t *testing.T) {
 	if _, err := db.Prepare("find-peers-by-email"); err != nil {
 		t.Fatal("Error in prepare statement", err)
@@ -183,6 +229,7 @@ func TestPrepare(t *testing.T) {
 	// Test the error in PrepareAll
 	m := []string{
 		"Error in preparing statement:",
+		"1:1:",
 		"spanac",
 		"; With query:",
 		"spanac $?;",
@@ -200,7 +247,7 @@ func TestPrepare(t *testing.T) {
 		t.Fatal(err)
 	}
 	// Check if all the queries are indeed prepared
-	for name, query := range db.qm {
+	for name, query := range db.reg.queries() {
 		if !query.isPrepared() {
 			t.Fatal("Query not prepared:", name)
 		}
@@ -0,0 +1,356 @@
+/*
+Package dotpgxtest provides a fake dotpgx.Querier for unit tests without PostgreSQL.
+
+The fake is created from a dotpgx.DB holding the parsed queries.
+No connection pool is needed to parse:
+
+	db := new(dotpgx.DB)
+	if err := db.ParsePath("queries"); err != nil {
+		t.Fatal(err)
+	}
+	fake := dotpgxtest.New(t, db)
+	fake.Expect("create-peer", "Foo", dotpgxtest.Any()).Return("INSERT 0 1")
+	fake.Expect("find-peers-by-email", "foo@bar.com").ReturnRows(Peer{Name: "Foo"})
+
+Expectations can only be set for query names that exist in the parsed queries.
+Calls are matched against the expectations in the order they were set.
+An unexpected call fails the test and returns ErrUnexpected.
+A call to an unknown query name fails the test as well.
+Expectations which are not met when the test finishes fail the test as well.
+
+The fake implements Exec, Get, Select and Prepare and their variants.
+Canned rows are assigned to the destination of Get and Select,
+so their type should be assignable to the destination (element) type.
+The pgx Rows, Row, Tx and Batch types cannot be created without a connection,
+so Query and QueryRow only return the canned error, or ErrNotSupported;
+Begin and BeginBatch are not supported at all.
+*/
+package dotpgxtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx"
+	"github.com/usrpro/dotpgx"
+)
+
+var (
+	// ErrUnexpected is returned for calls without a matching expectation.
+	ErrUnexpected = errors.New("Unexpected call")
+	// ErrNotSupported is returned by methods the fake cannot implement.
+	ErrNotSupported = errors.New("Not supported by dotpgxtest")
+)
+
+// Call is an expected call to a named query.
+type Call struct {
+	name  string
+	args  []interface{}
+	times int // Remaining number of calls, negative for unlimited
+	tag   pgx.CommandTag
+	rows  []interface{}
+	err   error
+}
+
+// Return sets the command tag returned by Exec.
+func (c *Call) Return(tag pgx.CommandTag) *Call {
+	c.tag = tag
+	return c
+}
+
+// ReturnRows sets the rows returned by Get and Select.
+func (c *Call) ReturnRows(rows ...interface{}) *Call {
+	c.rows = rows
+	return c
+}
+
+// ReturnError sets the error returned by the call.
+func (c *Call) ReturnError(err error) *Call {
+	c.err = err
+	return c
+}
+
+// Times sets how often the call is expected, 1 by default.
+// A negative n allows any number of calls, including none.
+func (c *Call) Times(n int) *Call {
+	c.times = n
+	return c
+}
+
+func (c *Call) String() string {
+	args := make([]string, len(c.args))
+	for i, a := range c.args {
+		args[i] = fmt.Sprint(a)
+	}
+	return fmt.Sprintf("%s(%s)", c.name, strings.Join(args, ", "))
+}
+
+func (c *Call) match(name string, args []interface{}) bool {
+	if c.times == 0 || c.name != name || len(c.args) != len(args) {
+		return false
+	}
+	for i, a := range c.args {
+		m, ok := a.(Matcher)
+		if !ok {
+			m = Eq(a)
+		}
+		if !m.Match(args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Fake implements dotpgx.Querier with expected calls and canned results.
+// It is safe for concurrent use.
+type Fake struct {
+	t     testing.TB
+	db    *dotpgx.DB
+	mu    sync.Mutex
+	calls []*Call
+}
+
+var _ dotpgx.Querier = (*Fake)(nil)
+
+// New returns a fake for the queries parsed in db.
+// Unmet expectations are reported when the test finishes.
+func New(t testing.TB, db *dotpgx.DB) *Fake {
+	f := &Fake{t: t, db: db}
+	t.Cleanup(func() {
+		if err := f.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return f
+}
+
+// Expect a call to the query identified by name.
+// Args can be values, which are compared with reflect.DeepEqual, or Matchers.
+// Named variants, like ExecNamed, are matched against their single argument.
+// The test fails immediately if the name is not defined in the parsed queries.
+func (f *Fake) Expect(name string, args ...interface{}) *Call {
+	f.t.Helper()
+	if _, err := f.db.Describe(name); err != nil {
+		f.t.Fatal(err)
+	}
+	c := &Call{
+		name:  name,
+		args:  args,
+		times: 1,
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, c)
+	f.mu.Unlock()
+	return c
+}
+
+// ExpectationsWereMet returns an error listing the expected calls that were not made.
+func (f *Fake) ExpectationsWereMet() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var unmet []string
+	for _, c := range f.calls {
+		if c.times > 0 {
+			unmet = append(unmet, c.String())
+		}
+	}
+	if len(unmet) > 0 {
+		return errors.New(strings.Join([]string{
+			"Unmet expectations", strings.Join(unmet, ", "),
+		}, ": "))
+	}
+	return nil
+}
+
+// call finds and consumes the expectation for a call.
+// A call to an unknown query name fails the test, like an unexpected call.
+func (f *Fake) call(name string, args ...interface{}) (*Call, error) {
+	f.t.Helper()
+	if _, err := f.db.Describe(name); err != nil {
+		f.t.Error(err)
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.calls {
+		if c.match(name, args) {
+			if c.times > 0 {
+				c.times--
+			}
+			return c, nil
+		}
+	}
+	c := &Call{name: name, args: args}
+	f.t.Errorf("%s: %s", ErrUnexpected, c)
+	return nil, fmt.Errorf("%w: %s", ErrUnexpected, c)
+}
+
+// Prepare returns a prepared statement holding the name and SQL of the query.
+func (f *Fake) Prepare(name string) (*pgx.PreparedStatement, error) {
+	return f.PrepareContext(context.Background(), name)
+}
+
+// PrepareContext returns a prepared statement holding the name and SQL of the query.
+// Prepare is not an expected call.
+func (f *Fake) PrepareContext(ctx context.Context, name string) (*pgx.PreparedStatement, error) {
+	info, err := f.db.Describe(name)
+	if err != nil {
+		return nil, err
+	}
+	return &pgx.PreparedStatement{Name: name, SQL: info.SQL}, nil
+}
+
+// rowsErr is returned by the methods which would return pgx.Rows or pgx.Row.
+func rowsErr(c *Call, err error) error {
+	if err != nil {
+		return err
+	}
+	if c.err != nil {
+		return c.err
+	}
+	return ErrNotSupported
+}
+
+// Query matches the call and returns its error, or ErrNotSupported.
+func (f *Fake) Query(name string, args ...interface{}) (*pgx.Rows, error) {
+	return f.QueryContext(context.Background(), name, args...)
+}
+
+// QueryContext matches the call and returns its error, or ErrNotSupported.
+func (f *Fake) QueryContext(ctx context.Context, name string, args ...interface{}) (*pgx.Rows, error) {
+	c, err := f.call(name, args...)
+	return nil, rowsErr(c, err)
+}
+
+// QueryRow matches the call and returns its error, or ErrNotSupported.
+func (f *Fake) QueryRow(name string, args ...interface{}) (*pgx.Row, error) {
+	return f.QueryRowContext(context.Background(), name, args...)
+}
+
+// QueryRowContext matches the call and returns its error, or ErrNotSupported.
+func (f *Fake) QueryRowContext(ctx context.Context, name string, args ...interface{}) (*pgx.Row, error) {
+	c, err := f.call(name, args...)
+	return nil, rowsErr(c, err)
+}
+
+// Exec matches the call and returns its command tag and error.
+func (f *Fake) Exec(name string, args ...interface{}) (pgx.CommandTag, error) {
+	return f.ExecContext(context.Background(), name, args...)
+}
+
+// ExecContext matches the call and returns its command tag and error.
+func (f *Fake) ExecContext(ctx context.Context, name string, args ...interface{}) (pgx.CommandTag, error) {
+	c, err := f.call(name, args...)
+	if err != nil {
+		return "", err
+	}
+	return c.tag, c.err
+}
+
+// QueryNamed is like Query.
+func (f *Fake) QueryNamed(name string, arg interface{}) (*pgx.Rows, error) {
+	return f.QueryContext(context.Background(), name, arg)
+}
+
+// QueryNamedContext is like QueryContext.
+func (f *Fake) QueryNamedContext(ctx context.Context, name string, arg interface{}) (*pgx.Rows, error) {
+	return f.QueryContext(ctx, name, arg)
+}
+
+// QueryRowNamed is like QueryRow.
+func (f *Fake) QueryRowNamed(name string, arg interface{}) (*pgx.Row, error) {
+	return f.QueryRowContext(context.Background(), name, arg)
+}
+
+// QueryRowNamedContext is like QueryRowContext.
+func (f *Fake) QueryRowNamedContext(ctx context.Context, name string, arg interface{}) (*pgx.Row, error) {
+	return f.QueryRowContext(ctx, name, arg)
+}
+
+// ExecNamed is like Exec.
+func (f *Fake) ExecNamed(name string, arg interface{}) (pgx.CommandTag, error) {
+	return f.ExecContext(context.Background(), name, arg)
+}
+
+// ExecNamedContext is like ExecContext.
+func (f *Fake) ExecNamedContext(ctx context.Context, name string, arg interface{}) (pgx.CommandTag, error) {
+	return f.ExecContext(ctx, name, arg)
+}
+
+// assign sets dest to row. A pointer row is dereferenced if needed.
+func assign(dest reflect.Value, row interface{}) error {
+	v := reflect.ValueOf(row)
+	if !v.Type().AssignableTo(dest.Type()) && v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.Type().AssignableTo(dest.Type()) {
+		return fmt.Errorf("Cannot assign row of type %s to %s", v.Type(), dest.Type())
+	}
+	dest.Set(v)
+	return nil
+}
+
+// Get matches the call and assigns its first row to dest.
+// Returns pgx.ErrNoRows if there are no canned rows.
+func (f *Fake) Get(ctx context.Context, dest interface{}, name string, args ...interface{}) error {
+	c, err := f.call(name, args...)
+	if err != nil {
+		return err
+	}
+	if c.err != nil {
+		return c.err
+	}
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Ptr || d.IsNil() {
+		return errors.New("Scan destination should be a non-nil pointer")
+	}
+	if len(c.rows) == 0 {
+		return pgx.ErrNoRows
+	}
+	return assign(d.Elem(), c.rows[0])
+}
+
+// Select matches the call and assigns its rows to dest, which should be a pointer to a slice.
+func (f *Fake) Select(ctx context.Context, dest interface{}, name string, args ...interface{}) error {
+	c, err := f.call(name, args...)
+	if err != nil {
+		return err
+	}
+	if c.err != nil {
+		return c.err
+	}
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Ptr || d.IsNil() || d.Elem().Kind() != reflect.Slice {
+		return errors.New("Scan destination should be a non-nil pointer to a slice")
+	}
+	s := reflect.MakeSlice(d.Elem().Type(), len(c.rows), len(c.rows))
+	for i, row := range c.rows {
+		if err = assign(s.Index(i), row); err != nil {
+			return err
+		}
+	}
+	d.Elem().Set(s)
+	return nil
+}
+
+// Begin is not supported and returns ErrNotSupported.
+func (f *Fake) Begin() (*dotpgx.Tx, error) {
+	return nil, ErrNotSupported
+}
+
+// BeginContext is not supported and returns ErrNotSupported.
+func (f *Fake) BeginContext(ctx context.Context) (*dotpgx.Tx, error) {
+	return nil, ErrNotSupported
+}
+
+// BeginBatch is not supported, it fails the test and returns nil.
+func (f *Fake) BeginBatch() *dotpgx.Batch {
+	f.t.Helper()
+	f.t.Error(ErrNotSupported, ": BeginBatch")
+	return nil
+}
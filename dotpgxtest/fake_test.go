@@ -0,0 +1,122 @@
+package dotpgxtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx"
+	"github.com/usrpro/dotpgx"
+)
+
+// recorder records failures instead of failing the test.
+type recorder struct {
+	testing.TB
+	failures []string
+	cleanup  func()
+}
+
+func (r *recorder) Helper()                                   {}
+func (r *recorder) Cleanup(f func())                          { r.cleanup = f }
+func (r *recorder) Error(args ...interface{})                 { r.failures = append(r.failures, fmt.Sprint(args...)) }
+func (r *recorder) Errorf(format string, args ...interface{}) { r.Error(fmt.Sprintf(format, args...)) }
+func (r *recorder) Fatal(args ...interface{})                 { r.Error(args...) }
+
+func newFake(t *testing.T) (*Fake, *recorder) {
+	db := new(dotpgx.DB)
+	if err := db.ParsePath("../tests/queries"); err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{TB: t}
+	return New(r, db), r
+}
+
+type peer struct {
+	Name  string
+	Email string
+}
+
+func TestFake(t *testing.T) {
+	f, r := newFake(t)
+	ctx := context.Background()
+
+	f.Expect("create-peer", "Foo", Any()).Return("INSERT 0 1")
+	f.Expect("find-peers-by-email", Func("example.com address", func(arg interface{}) bool {
+		s, ok := arg.(string)
+		return ok && strings.HasSuffix(s, "@example.com")
+	})).ReturnRows(peer{"Foo", "foo@example.com"}, &peer{"Bar", "bar@example.com"}).Times(2)
+	f.Expect("find-one-peer-by-email", TypeOf(""))
+	errExp := errors.New("Boom")
+	f.Expect("create-peer-named", peer{"Err", "err@example.com"}).ReturnError(errExp)
+
+	tag, err := f.Exec("create-peer", "Foo", "foo@example.com")
+	if err != nil || tag != "INSERT 0 1" {
+		t.Fatal("Wrong exec result:", tag, err)
+	}
+	var ps []peer
+	if err = f.Select(ctx, &ps, "find-peers-by-email", "foo@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []peer{{"Foo", "foo@example.com"}, {"Bar", "bar@example.com"}}; !reflect.DeepEqual(exp, ps) {
+		t.Fatal("\nExpected:\n", exp, "\nGot:\n", ps)
+	}
+	var p peer
+	if err = f.Get(ctx, &p, "find-peers-by-email", "bar@example.com"); err != nil || p.Name != "Foo" {
+		t.Fatal("Wrong get result:", p, err)
+	}
+	if err = f.Get(ctx, &p, "find-one-peer-by-email", "nobody@example.com"); err != pgx.ErrNoRows {
+		t.Fatal("Expected:", pgx.ErrNoRows, "Got:", err)
+	}
+	if _, err = f.ExecNamed("create-peer-named", peer{"Err", "err@example.com"}); err != errExp {
+		t.Fatal("Expected:", errExp, "Got:", err)
+	}
+	ps2, err := f.Prepare("find-one-peer-by-email")
+	if err != nil || ps2.SQL != "SELECT name,email FROM peers WHERE email = $1 LIMIT 1;" {
+		t.Fatal("Wrong prepared statement:", ps2, err)
+	}
+	if err = f.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.failures) > 0 {
+		t.Fatal("Unexpected failures:", r.failures)
+	}
+}
+
+func TestFakeFailures(t *testing.T) {
+	f, r := newFake(t)
+	ctx := context.Background()
+
+	f.Expect("no-such-query")
+	if len(r.failures) != 1 {
+		t.Fatal("Expected failure for unknown query name, got:", r.failures)
+	}
+	if _, err := f.Exec("no-such-query"); !errors.Is(err, dotpgx.ErrUnknownQuery) || len(r.failures) != 2 {
+		t.Fatal("Expected failure and error for unknown query name, got:", err, r.failures)
+	}
+
+	f.Expect("create-peer", "Foo", "foo@example.com")
+	f.Expect("sleep", 1)
+	if _, err := f.Exec("create-peer", "Bar", "bar@example.com"); !errors.Is(err, ErrUnexpected) {
+		t.Fatal("Expected:", ErrUnexpected, "Got:", err)
+	}
+	if len(r.failures) != 3 {
+		t.Fatal("Expected failure for unexpected call, got:", r.failures)
+	}
+	if _, err := f.QueryContext(ctx, "create-peer", "Foo", "foo@example.com"); err != ErrNotSupported {
+		t.Fatal("Expected:", ErrNotSupported, "Got:", err)
+	}
+	var n int
+	f.Expect("find-one-peer-by-email", "x").ReturnRows("not an int")
+	if err := f.Get(ctx, &n, "find-one-peer-by-email", "x"); err == nil {
+		t.Fatal("Expected error for unassignable row")
+	}
+
+	// Unmet expectations are reported on cleanup
+	r.cleanup()
+	if len(r.failures) != 4 || !strings.Contains(r.failures[3], "sleep(1)") {
+		t.Fatal("Expected failure for unmet expectation, got:", r.failures)
+	}
+}
@@ -0,0 +1,61 @@
+package dotpgxtest
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Matcher matches an argument of a call.
+type Matcher interface {
+	Match(arg interface{}) bool
+	String() string
+}
+
+type anyMatcher struct{}
+
+func (anyMatcher) Match(interface{}) bool { return true }
+func (anyMatcher) String() string         { return "<any>" }
+
+// Any matches any argument.
+func Any() Matcher {
+	return anyMatcher{}
+}
+
+type eqMatcher struct {
+	v interface{}
+}
+
+func (m eqMatcher) Match(arg interface{}) bool { return reflect.DeepEqual(m.v, arg) }
+func (m eqMatcher) String() string             { return fmt.Sprint(m.v) }
+
+// Eq matches arguments deeply equal to v.
+// It is used for expected arguments which are not a Matcher.
+func Eq(v interface{}) Matcher {
+	return eqMatcher{v}
+}
+
+type funcMatcher struct {
+	desc string
+	fn   func(interface{}) bool
+}
+
+func (m funcMatcher) Match(arg interface{}) bool { return m.fn(arg) }
+func (m funcMatcher) String() string             { return m.desc }
+
+// Func matches arguments for which fn returns true.
+// Desc describes the matcher in failure messages.
+func Func(desc string, fn func(arg interface{}) bool) Matcher {
+	return funcMatcher{desc, fn}
+}
+
+type typeMatcher struct {
+	t reflect.Type
+}
+
+func (m typeMatcher) Match(arg interface{}) bool { return reflect.TypeOf(arg) == m.t }
+func (m typeMatcher) String() string             { return "<" + m.t.String() + ">" }
+
+// TypeOf matches arguments of the same type as v.
+func TypeOf(v interface{}) Matcher {
+	return typeMatcher{reflect.TypeOf(v)}
+}
@@ -0,0 +1,175 @@
+package dotpgx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx"
+)
+
+// Position in a SQL source.
+// File is empty for queries parsed by ParseSQL, which has no file name.
+type Position struct {
+	File   string
+	Line   int
+	Column int // Byte offset in the line, starting at 1
+}
+
+// String returns the position as "file:line:column".
+// Unknown parts are left out.
+func (p Position) String() string {
+	switch {
+	case p.Line == 0:
+		return p.File
+	case p.File == "":
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	default:
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	}
+}
+
+// ParseError is returned when SQL input cannot be parsed.
+type ParseError struct {
+	Pos Position
+	Msg string
+	// Err is the cause, like ErrNothingParsed. It may be nil.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if pos := e.Pos.String(); pos != "" {
+		return pos + ": " + e.Msg
+	}
+	return e.Msg
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// DuplicateError is returned by the parser when a query name is defined more than once.
+// See DB.Duplicates.
+type DuplicateError struct {
+	Name string
+	// First and Second are the positions of both definitions.
+	First, Second Position
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("Duplicate query name %q: defined at %s and %s", e.Name, e.First, e.Second)
+}
+
+// Sentinel errors, to be checked with errors.Is.
+var (
+	// ErrUnknownQuery is returned for a query name that is not registered.
+	ErrUnknownQuery = errors.New("Unknown query")
+	// ErrNothingParsed is wrapped by the ParseError of input without queries.
+	ErrNothingParsed = errors.New("Nothing parsed")
+	// ErrNoFiles is returned when no files match the paths or patterns to parse.
+	ErrNoFiles = errors.New("No files to parse")
+	// ErrOpenNested is returned when committing a transaction with open nested transactions.
+	ErrOpenNested = errors.New("Cannot commit transaction with open nested transactions")
+)
+
+// QueryError is returned when preparing or executing a named query fails.
+// Execution errors are only wrapped if they are reported by PostgreSQL,
+// use errors.As with a *pgx.PgError target to get it.
+type QueryError struct {
+	Name string
+	// Pos is the source position of the query.
+	Pos Position
+	Err error
+}
+
+func (e *QueryError) Error() string {
+	if pos := e.Pos.String(); pos != "" {
+		return pos + ": " + e.Name + ": " + e.Err.Error()
+	}
+	return e.Name + ": " + e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError holds the errors of an operation that continues after a failure,
+// like PrepareAll and ClearMap. errors.Is and errors.As match each of the errors.
+type MultiError []error
+
+func (e MultiError) Error() string {
+	msg := make([]string, len(e))
+	for i, err := range e {
+		msg[i] = err.Error()
+	}
+	return strings.Join(msg, "\n")
+}
+
+func (e MultiError) Unwrap() []error {
+	return e
+}
+
+// err returns e, or nil if e is empty.
+func (e MultiError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// msgError has a custom message and wraps err.
+type msgError struct {
+	msg string
+	err error
+}
+
+func (e *msgError) Error() string {
+	return e.msg
+}
+
+func (e *msgError) Unwrap() error {
+	return e.err
+}
+
+// SQLState codes checked by the helpers below.
+const (
+	CodeForeignKeyViolation  = "23503"
+	CodeUniqueViolation      = "23505"
+	CodeSerializationFailure = "40001"
+	CodeDeadlockDetected     = "40P01"
+)
+
+// SQLState returns the SQLSTATE code of a PostgreSQL error in the chain of err.
+// An empty string is returned if there is none.
+func SQLState(err error) string {
+	var pe pgx.PgError
+	if errors.As(err, &pe) {
+		return pe.Code
+	}
+	var ppe *pgx.PgError
+	if errors.As(err, &ppe) && ppe != nil {
+		return ppe.Code
+	}
+	return ""
+}
+
+// IsUniqueViolation reports if err is caused by a unique constraint violation.
+func IsUniqueViolation(err error) bool {
+	return SQLState(err) == CodeUniqueViolation
+}
+
+// IsForeignKeyViolation reports if err is caused by a foreign key constraint violation.
+func IsForeignKeyViolation(err error) bool {
+	return SQLState(err) == CodeForeignKeyViolation
+}
+
+// IsSerializationFailure reports if err is caused by a serialization failure,
+// meaning the transaction can be retried.
+func IsSerializationFailure(err error) bool {
+	return SQLState(err) == CodeSerializationFailure
+}
+
+// IsNotFound reports if err is pgx.ErrNoRows, as returned by Get and Row.Scan.
+func IsNotFound(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows)
+}
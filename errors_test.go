@@ -0,0 +1,121 @@
+package dotpgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	cdb := new(DB)
+	_, err := cdb.Describe("none")
+	if !errors.Is(err, ErrUnknownQuery) || err.Error() != "Unknown query: none" {
+		t.Error("Expected ErrUnknownQuery, got:", err)
+	}
+	err = cdb.ParseSQL(strings.NewReader("-- just a comment"))
+	var pe *ParseError
+	if !errors.Is(err, ErrNothingParsed) || !errors.As(err, &pe) {
+		t.Error("Expected ErrNothingParsed in a ParseError, got:", err)
+	}
+	if err = cdb.ParseFiles(); err != ErrNoFiles {
+		t.Error("Expected ErrNoFiles, got:", err)
+	}
+	if err = cdb.ParsePath("_"); !errors.Is(err, ErrNoFiles) {
+		t.Error("Expected ErrNoFiles, got:", err)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	pgErr := pgx.PgError{Severity: "ERROR", Code: CodeUniqueViolation, Message: "duplicate key"}
+	tests := []struct {
+		err *QueryError
+		exp string
+	}{
+		{&QueryError{Name: "one", Err: pgErr}, "one: ERROR: duplicate key (SQLSTATE 23505)"},
+		{&QueryError{Name: "one", Pos: Position{File: "a.sql", Line: 2, Column: 1}, Err: pgErr}, "a.sql:2:1: one: ERROR: duplicate key (SQLSTATE 23505)"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.exp {
+			t.Error("Expected:", tt.exp, "Got:", got)
+		}
+		var got pgx.PgError
+		if !errors.As(tt.err, &got) || got.Code != CodeUniqueViolation {
+			t.Error("PgError not wrapped:", tt.err)
+		}
+	}
+
+	var r registry
+	r.qm = queryMap{"one": {sql: "select 1;", start: Position{Line: 1, Column: 1}}}
+	if err := r.wrap("one", pgErr); !errors.As(err, new(*QueryError)) {
+		t.Error("Expected a QueryError, got:", err)
+	}
+	if err := r.wrap("one", pgx.ErrTxClosed); err != pgx.ErrTxClosed {
+		t.Error("Non PostgreSQL error wrapped:", err)
+	}
+	if err := r.wrap("two", pgErr); err != error(pgErr) {
+		t.Error("Unknown query wrapped:", err)
+	}
+}
+
+func TestMultiError(t *testing.T) {
+	if MultiError(nil).err() != nil {
+		t.Fatal("Expected nil error for empty MultiError")
+	}
+	errA := errors.New("A")
+	err := MultiError{
+		errA,
+		&QueryError{Name: "one", Err: pgx.PgError{Code: CodeSerializationFailure}},
+	}.err()
+	if !strings.HasPrefix(err.Error(), "A\none: ") {
+		t.Error("Wrong message:", err)
+	}
+	if !errors.Is(err, errA) || !IsSerializationFailure(err) {
+		t.Error("Errors not matched in:", err)
+	}
+	var qe *QueryError
+	if !errors.As(err, &qe) || qe.Name != "one" {
+		t.Error("QueryError not found in:", err)
+	}
+
+	cause := context.Canceled
+	perr := prepareError("one", &query{sql: "select 1;", start: Position{Line: 1, Column: 1}}, cause)
+	if exp := "Error in preparing statement: 1:1: one ; With query: select 1;"; perr.Error() != exp {
+		t.Error("Expected:", exp, "Got:", perr)
+	}
+	if !errors.Is(perr, cause) {
+		t.Error("Cause not wrapped:", perr)
+	}
+}
+
+func TestErrorHelpers(t *testing.T) {
+	wrap := func(code string) error {
+		return fmt.Errorf("wrapped: %w", &QueryError{Name: "q", Err: pgx.PgError{Code: code}})
+	}
+	tests := []struct {
+		fn   func(error) bool
+		err  error
+		want bool
+	}{
+		{IsUniqueViolation, wrap(CodeUniqueViolation), true},
+		{IsUniqueViolation, &pgx.PgError{Code: CodeUniqueViolation}, true},
+		{IsUniqueViolation, wrap(CodeForeignKeyViolation), false},
+		{IsForeignKeyViolation, wrap(CodeForeignKeyViolation), true},
+		{IsSerializationFailure, wrap(CodeSerializationFailure), true},
+		{IsSerializationFailure, wrap(CodeDeadlockDetected), false},
+		{IsNotFound, fmt.Errorf("get: %w", pgx.ErrNoRows), true},
+		{IsNotFound, errors.New("no rows"), false},
+		{IsUniqueViolation, nil, false},
+	}
+	for i, tt := range tests {
+		if got := tt.fn(tt.err); got != tt.want {
+			t.Error(i, tt.err, "Expected:", tt.want, "Got:", got)
+		}
+	}
+	if got := SQLState(errors.New("23505")); got != "" {
+		t.Error("Expected empty SQLSTATE, got:", got)
+	}
+}
@@ -0,0 +1,91 @@
+package dotpgx
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// fieldCache holds the fieldIndex results per struct type.
+var fieldCache sync.Map
+
+// fieldIndex maps names to the index paths of the fields in struct type t.
+// A field is named by its "db" tag, or by its snake_cased name if there is no tag.
+// Fields tagged with "-" and unexported fields are skipped.
+// Fields of embedded structs without a tag are promoted, like in Go itself;
+// a field of the outer struct wins from one with the same name in an embedded struct.
+func fieldIndex(t reflect.Type) map[string][]int {
+	if fi, ok := fieldCache.Load(t); ok {
+		return fi.(map[string][]int)
+	}
+	fi := make(map[string][]int)
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, f)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if tag == "" {
+			tag = snakeCase(f.Name)
+		}
+		fi[tag] = f.Index
+	}
+	for _, f := range embedded {
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		for name, index := range fieldIndex(ft) {
+			if _, ok := fi[name]; !ok {
+				fi[name] = append(append([]int{}, f.Index...), index...)
+			}
+		}
+	}
+	fieldCache.Store(t, fi)
+	return fi
+}
+
+// fieldValue returns the field of struct v at index.
+// Ok is false if index runs through a nil pointer to an embedded struct.
+func fieldValue(v reflect.Value, index []int) (f reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// snakeCase converts a Go identifier like "UserID" into "user_id".
+func snakeCase(s string) string {
+	r := []rune(s)
+	var b strings.Builder
+	for i, c := range r {
+		if unicode.IsUpper(c) {
+			if i > 0 && (unicode.IsLower(r[i-1]) || unicode.IsDigit(r[i-1]) ||
+				(i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package dotpgx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"Name":       "name",
+		"UserID":     "user_id",
+		"ID":         "id",
+		"HTTPServer": "http_server",
+		"Address2":   "address2",
+		"V2Name":     "v2_name",
+	}
+	for in, exp := range tests {
+		if got := snakeCase(in); got != exp {
+			t.Error("snakeCase", in, "Expected:", exp, "Got:", got)
+		}
+	}
+}
+
+type base struct {
+	ID    int
+	Email string
+}
+
+type withBase struct {
+	*base
+	Name    string `db:"full_name"`
+	Email   string
+	Skip    string `db:"-"`
+	private string
+}
+
+func TestFieldIndex(t *testing.T) {
+	exp := map[string][]int{
+		"id":        {0, 0},
+		"full_name": {1},
+		"email":     {2},
+	}
+	got := fieldIndex(reflect.TypeOf(withBase{}))
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatal("\nExpected:\n", exp, "\nGot:\n", got)
+	}
+	// Nil embedded pointer
+	v := reflect.ValueOf(withBase{})
+	if _, ok := fieldValue(v, got["id"]); ok {
+		t.Fatal("Expected no value for nil embedded struct")
+	}
+	v = reflect.ValueOf(withBase{base: &base{ID: 3}})
+	if f, ok := fieldValue(v, got["id"]); !ok || f.Interface() != 3 {
+		t.Fatal("Expected: 3 Got:", f)
+	}
+}
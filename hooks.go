@@ -0,0 +1,146 @@
+package dotpgx
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// Operations reported in QueryEvent.Op.
+const (
+	OpQuery    = "query"
+	OpQueryRow = "query_row"
+	OpExec     = "exec"
+	OpPrepare  = "prepare"
+	OpBegin    = "begin"
+	OpCommit   = "commit"
+	OpRollback = "rollback"
+	OpBatch    = "batch"
+)
+
+// QueryEvent describes a named query execution, or a transaction or batch operation.
+type QueryEvent struct {
+	// Op is one of the Op* constants.
+	Op string
+	// Name of the query. Empty for transaction and batch operations.
+	Name string
+	// SQL of the query, as it is sent to the database.
+	SQL  string
+	Args []interface{}
+	// Queued holds the names of the queries in a batch.
+	Queued []string
+	// Tx is the transaction the operation runs in, nil if it runs on the pool.
+	// For OpBegin, it is set to the new transaction in AfterQuery,
+	// in BeforeQuery it is the parent of a nested transaction.
+	Tx    *Tx
+	Start time.Time
+	// Duration of the operation, set in AfterQuery.
+	// Query and QueryRow finish when the first result arrives,
+	// reading the rows is not included.
+	Duration time.Duration
+	// RowsAffected by Exec, set in AfterQuery.
+	RowsAffected int64
+}
+
+// Hook is called around every operation on a DB and its transactions and batches.
+// BeforeQuery returns the context to use for the operation,
+// which is passed to AfterQuery of the same hook.
+// AfterQuery receives the error of the operation.
+// For QueryRow, AfterQuery only receives the errors of sending the query,
+// like a connection error or wrong arguments. Errors of executing the query
+// and pgx.ErrNoRows are deferred until Scan and not reported to the hooks.
+type Hook interface {
+	BeforeQuery(ctx context.Context, ev QueryEvent) context.Context
+	AfterQuery(ctx context.Context, ev QueryEvent, err error)
+}
+
+// hookRun holds the state of the hooks for a single operation.
+type hookRun struct {
+	hooks []Hook
+	ctxs  []context.Context
+	ev    QueryEvent
+}
+
+// startHooks calls BeforeQuery of each hook in order, and returns the resulting context.
+// The returned hookRun is nil if there are no hooks.
+func startHooks(ctx context.Context, hooks []Hook, ev QueryEvent) (context.Context, *hookRun) {
+	if len(hooks) == 0 {
+		return ctx, nil
+	}
+	ev.Start = time.Now()
+	r := &hookRun{
+		hooks: hooks,
+		ctxs:  make([]context.Context, len(hooks)),
+	}
+	for i, h := range hooks {
+		ctx = h.BeforeQuery(ctx, ev)
+		r.ctxs[i] = ctx
+	}
+	r.ev = ev
+	return ctx, r
+}
+
+// end calls AfterQuery of each hook in reverse order.
+func (r *hookRun) end(err error) {
+	if r == nil {
+		return
+	}
+	r.ev.Duration = time.Since(r.ev.Start)
+	for i := len(r.hooks) - 1; i >= 0; i-- {
+		r.hooks[i].AfterQuery(r.ctxs[i], r.ev, err)
+	}
+}
+
+// endExec sets the rows affected from tag and ends the hooks.
+func (r *hookRun) endExec(tag pgx.CommandTag, err error) {
+	if r == nil {
+		return
+	}
+	r.ev.RowsAffected = tag.RowsAffected()
+	r.end(err)
+}
+
+// endTx sets the transaction begun by the operation and ends the hooks.
+func (r *hookRun) endTx(tx *Tx, err error) {
+	if r == nil {
+		return
+	}
+	r.ev.Tx = tx
+	r.end(err)
+}
+
+// event returns a QueryEvent for the query identified by name.
+// Unknown queries result in an empty SQL.
+func (reg *registry) event(op, name string, args []interface{}, tx *Tx) QueryEvent {
+	ev := QueryEvent{
+		Op:   op,
+		Name: name,
+		Args: args,
+		Tx:   tx,
+	}
+	if q, err := reg.getQuery(name); err == nil {
+		ev.SQL = q.sql
+	}
+	return ev
+}
+
+// hook starts the hooks of db for a named query operation.
+func (db *DB) hook(ctx context.Context, op, name string, args []interface{}) (context.Context, *hookRun) {
+	if len(db.Hooks) == 0 {
+		return ctx, nil
+	}
+	return startHooks(ctx, db.Hooks, db.reg.event(op, name, args, nil))
+}
+
+// hook starts the hooks of tx for a named query operation.
+// An empty name is used for transaction operations.
+func (tx *Tx) hook(ctx context.Context, op, name string, args []interface{}) (context.Context, *hookRun) {
+	if len(tx.hooks) == 0 {
+		return ctx, nil
+	}
+	if name == "" {
+		return startHooks(ctx, tx.hooks, QueryEvent{Op: op, Tx: tx})
+	}
+	return startHooks(ctx, tx.hooks, tx.reg.event(op, name, args, tx))
+}
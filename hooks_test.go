@@ -0,0 +1,145 @@
+package dotpgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type hookKey string
+
+// recordHook records the events it receives, prefixed with its name.
+type recordHook struct {
+	name   string
+	calls  *[]string
+	events []QueryEvent
+	errs   []error
+}
+
+func (h *recordHook) BeforeQuery(ctx context.Context, ev QueryEvent) context.Context {
+	*h.calls = append(*h.calls, fmt.Sprint("before ", h.name, " ", ev.Op, " ", ev.Name))
+	return context.WithValue(ctx, hookKey(h.name), true)
+}
+
+func (h *recordHook) AfterQuery(ctx context.Context, ev QueryEvent, err error) {
+	if ctx.Value(hookKey(h.name)) == nil {
+		*h.calls = append(*h.calls, "missing context of "+h.name)
+	}
+	*h.calls = append(*h.calls, fmt.Sprint("after ", h.name, " ", ev.Op, " ", ev.Name))
+	h.events = append(h.events, ev)
+	h.errs = append(h.errs, err)
+}
+
+func TestStartHooks(t *testing.T) {
+	var calls []string
+	a := &recordHook{name: "a", calls: &calls}
+	b := &recordHook{name: "b", calls: &calls}
+	ctx, h := startHooks(context.Background(), []Hook{a, b}, QueryEvent{Op: OpExec, Name: "one"})
+	if ctx.Value(hookKey("a")) == nil || ctx.Value(hookKey("b")) == nil {
+		t.Fatal("Context of hooks not returned")
+	}
+	errExec := errors.New("Failed")
+	h.end(errExec)
+	exp := []string{
+		"before a exec one",
+		"before b exec one",
+		"after b exec one",
+		"after a exec one",
+	}
+	if !reflect.DeepEqual(calls, exp) {
+		t.Fatal("Expected:", exp, "Got:", calls)
+	}
+	if a.errs[0] != errExec || a.events[0].Start.IsZero() {
+		t.Error("Wrong event or error:", a.events[0], a.errs[0])
+	}
+
+	// No hooks
+	if ctx, h = startHooks(context.Background(), nil, QueryEvent{}); h != nil {
+		t.Fatal("Expected nil hookRun")
+	}
+	h.end(nil)
+}
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	cdb, err := New(Default.ConnPoolConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cdb.Close()
+	var calls []string
+	rec := &recordHook{name: "rec", calls: &calls}
+	cdb.Hooks = []Hook{rec}
+	if err = cdb.ParsePath(queriesDir); err != nil {
+		t.Fatal(err)
+	}
+
+	const email = "hooks@example.com"
+	tx, err := cdb.BeginContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err = tx.Prepare("create-peer"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("create-peer", "Hooked", email); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := tx.Query("find-peers-by-email", email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	b := tx.BeginBatch()
+	if err = b.Queue("find-peers-by-email", []interface{}{email}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Send(); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := make([]string, len(rec.events))
+	for i, ev := range rec.events {
+		ops[i] = ev.Op
+		if ev.Tx != tx {
+			t.Error("Wrong Tx in event:", ev.Op)
+		}
+	}
+	exp := []string{OpBegin, OpPrepare, OpExec, OpQuery, OpBatch, OpRollback}
+	if !reflect.DeepEqual(ops, exp) {
+		t.Fatal("Expected:", exp, "Got:", ops)
+	}
+	exec := rec.events[2]
+	if exec.Name != "create-peer" || exec.RowsAffected != 1 || !strings.Contains(exec.SQL, "INSERT") {
+		t.Error("Wrong exec event:", exec)
+	}
+	if !reflect.DeepEqual(exec.Args, []interface{}{"Hooked", email}) {
+		t.Error("Wrong args:", exec.Args)
+	}
+	if q := rec.events[4].Queued; len(q) != 1 || q[0] != "find-peers-by-email" {
+		t.Error("Wrong queued queries:", q)
+	}
+
+	// Errors are reported
+	if _, err = cdb.Exec("create-peer"); err == nil {
+		t.Fatal("Expected error for missing arguments")
+	}
+	if last := rec.errs[len(rec.errs)-1]; last != err {
+		t.Error("Expected:", err, "Got:", last)
+	}
+	row, err := cdb.QueryRow("create-peer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := rec.errs[len(rec.errs)-1]; last == nil || row.Scan() == nil {
+		t.Error("Expected QueryRow error, got:", last)
+	}
+}
@@ -0,0 +1,414 @@
+package dotpgx
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// statement is a single SQL statement as produced by the lexer.
+type statement struct {
+	name   string   // Value of the name tag, empty for unnamed statements
+	sql    string   // Named parameters are rewritten to positional parameters
+	params []string // Named parameters, in positional order
+	ann    annotations
+	start  Position // Position of the name tag, or the first token if unnamed
+	end    Position // Position of the last token
+}
+
+// lexer splits SQL input into statements.
+// It is aware of single quoted strings (including E'...' escape strings),
+// double quoted identifiers, line and (nested) block comments and dollar quotes.
+// Outside of strings and identifiers, comments are removed
+// and every run of whitespace is collapsed into a single space.
+//
+// A dollar quote ($$ or $tag$) is kept as-is up to the next identical tag,
+// so function bodies in any language may contain quotes, comments
+// and dollar quotes with other tags.
+//
+// Named parameters (:name or @name) are rewritten to positional parameters ($1).
+// Each name gets a single position, in order of first appearance.
+// Type casts (::int), operators ending on @ (@@, <@) and parameters
+// inside dollar quotes are left alone.
+//
+// Comment lines of the form "-- key: value" are annotations.
+// They belong to the current statement or, in between statements, to the next one.
+//
+// In raw mode, named parameters and annotations are left alone.
+type lexer struct {
+	file  string
+	raw   bool
+	src   string
+	pos   int
+	last  int  // Offset of the last byte of the last token
+	bol   bool // Only whitespace seen since the beginning of the line
+	space bool // A separator is pending before the next token
+	cur   *statement
+	ann   annotations // Annotations found in between statements
+	pos1  bool        // The current statement contains a positional parameter
+	buf   strings.Builder
+	stmts []statement
+
+	// State of position, to avoid counting lines from the start every time.
+	lpos, line, lstart int
+}
+
+// lexSQL reads all of r and returns the statements found in it.
+// File is only used for positions and may be empty.
+func lexSQL(r io.Reader, file string) ([]statement, error) {
+	return lex(r, file, false)
+}
+
+// SplitSQL returns the statements of the SQL script in r, in source order.
+// Statements are split like ParseSQL does, but named parameters are not rewritten
+// and comment lines like "-- name: <name>" are ignored, as are other annotations.
+// This is meant for scripts that are executed as-is, like migrations.
+// File is only used for the positions of a *ParseError and may be empty.
+func SplitSQL(r io.Reader, file string) ([]string, error) {
+	stmts, err := lex(r, file, true)
+	if err != nil {
+		return nil, err
+	}
+	sqls := make([]string, len(stmts))
+	for i, s := range stmts {
+		sqls[i] = s.sql
+	}
+	return sqls, nil
+}
+
+// lex implements lexSQL and SplitSQL.
+func lex(r io.Reader, file string, raw bool) ([]statement, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	l := &lexer{
+		file: file,
+		raw:  raw,
+		src:  string(b),
+		bol:  true,
+		line: 1,
+	}
+	if err = l.run(); err != nil {
+		return nil, err
+	}
+	return l.stmts, nil
+}
+
+// position returns the position of the byte at offset pos.
+func (l *lexer) position(pos int) Position {
+	if pos < l.lpos {
+		l.lpos, l.line, l.lstart = 0, 1, 0
+	}
+	for ; l.lpos < pos; l.lpos++ {
+		if l.src[l.lpos] == '\n' {
+			l.line++
+			l.lstart = l.lpos + 1
+		}
+	}
+	return Position{
+		File:   l.file,
+		Line:   l.line,
+		Column: pos - l.lstart + 1,
+	}
+}
+
+// errorf returns a ParseError for the byte at offset pos.
+func (l *lexer) errorf(pos int, format string, args ...interface{}) error {
+	return &ParseError{
+		Pos: l.position(pos),
+		Msg: fmt.Sprintf(format, args...),
+	}
+}
+
+func (l *lexer) hasPrefix(s string) bool {
+	return strings.HasPrefix(l.src[l.pos:], s)
+}
+
+func (l *lexer) run() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.pos++
+			l.bol = true
+			l.space = true
+			continue
+		case isSpace(c):
+			l.pos++
+			l.space = true
+			continue
+		case l.hasPrefix("--"):
+			if err := l.lineComment(); err != nil {
+				return err
+			}
+			continue
+		case l.hasPrefix("/*"):
+			if err := l.blockComment(); err != nil {
+				return err
+			}
+			l.bol = false
+			continue
+		case c == '\'':
+			if err := l.quoted('\'', false); err != nil {
+				return err
+			}
+		case c == '"':
+			if err := l.quoted('"', false); err != nil {
+				return err
+			}
+		case (c == 'e' || c == 'E') && l.hasPrefix(string(c)+"'") && !l.afterIdent():
+			l.write(string(c))
+			l.pos++
+			if err := l.quoted('\'', true); err != nil {
+				return err
+			}
+		case c == '$' && l.dollarTag() != "":
+			if err := l.dollarQuote(); err != nil {
+				return err
+			}
+		case (c == ':' || c == '@') && !l.raw && l.paramName() != "":
+			l.namedParam()
+		case c == '$' && l.positional():
+			l.write("$")
+			l.pos++
+			l.pos1 = true
+		case c == ';':
+			l.write(";")
+			l.pos++
+			l.last = l.pos - 1
+			if err := l.flush(); err != nil {
+				return err
+			}
+		default:
+			l.write(string(c))
+			l.pos++
+		}
+		l.bol = false
+		l.last = l.pos - 1
+	}
+	return l.flush()
+}
+
+// afterIdent reports if the previous byte in the source is part of an identifier.
+func (l *lexer) afterIdent() bool {
+	return l.pos > 0 && isIdent(l.src[l.pos-1])
+}
+
+// write appends s to the current statement,
+// starting a new unnamed statement if there is none.
+func (l *lexer) write(s string) {
+	if l.cur == nil {
+		l.start("")
+	}
+	if l.space && l.buf.Len() > 0 {
+		l.buf.WriteByte(' ')
+	}
+	l.space = false
+	l.buf.WriteString(s)
+}
+
+// start a new statement, which takes the pending annotations.
+func (l *lexer) start(name string) {
+	l.cur = &statement{
+		name:  name,
+		ann:   l.ann,
+		start: l.position(l.pos),
+	}
+	l.ann = nil
+}
+
+// flush terminates the current statement, if any.
+func (l *lexer) flush() error {
+	if l.cur == nil {
+		return nil
+	}
+	if l.buf.Len() == 0 {
+		return &ParseError{
+			Pos: l.cur.start,
+			Msg: "Name tag without query body: " + l.cur.name,
+		}
+	}
+	if l.pos1 && len(l.cur.params) > 0 {
+		return &ParseError{
+			Pos: l.cur.start,
+			Msg: "Mixed named and positional parameters",
+		}
+	}
+	l.cur.sql = l.buf.String()
+	l.cur.end = l.position(l.last)
+	l.stmts = append(l.stmts, *l.cur)
+	l.cur = nil
+	l.pos1 = false
+	l.buf.Reset()
+	l.space = false
+	return nil
+}
+
+// lineComment skips a comment until the end of the line.
+// If the comment is a name tag on a line of its own,
+// the current statement is terminated and a new named statement is started.
+// Other annotations on a line of their own are recorded.
+func (l *lexer) lineComment() error {
+	end := strings.IndexByte(l.src[l.pos:], '\n')
+	if end < 0 {
+		end = len(l.src)
+	} else {
+		end += l.pos
+	}
+	text := strings.TrimSpace(l.src[l.pos+2 : end])
+	if key, value := annotation(text); l.bol && !l.raw && key != "" {
+		if key == "name" {
+			if err := l.flush(); err != nil {
+				return err
+			}
+			l.start(value)
+		} else if l.cur != nil {
+			l.cur.ann = l.cur.ann.add(key, value)
+		} else {
+			l.ann = l.ann.add(key, value)
+		}
+	}
+	l.pos = end
+	l.space = true
+	return nil
+}
+
+// blockComment skips a block comment. Block comments may be nested.
+func (l *lexer) blockComment() error {
+	start := l.pos
+	depth := 0
+	for l.pos < len(l.src) {
+		switch {
+		case l.hasPrefix("/*"):
+			depth++
+			l.pos += 2
+		case l.hasPrefix("*/"):
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				l.space = true
+				return nil
+			}
+		default:
+			l.pos++
+		}
+	}
+	return l.errorf(start, "Unterminated block comment")
+}
+
+// quoted writes a string literal or quoted identifier verbatim.
+// A doubled quote character does not terminate the literal.
+// If backslash is set, a backslash escapes the following character, as in E'...' strings.
+func (l *lexer) quoted(q byte, backslash bool) error {
+	for i := l.pos + 1; i < len(l.src); i++ {
+		switch {
+		case backslash && l.src[i] == '\\':
+			i++
+		case l.src[i] == q && i+1 < len(l.src) && l.src[i+1] == q:
+			i++
+		case l.src[i] == q:
+			l.write(l.src[l.pos : i+1])
+			l.pos = i + 1
+			return nil
+		}
+	}
+	if q == '"' {
+		return l.errorf(l.pos, "Unterminated quoted identifier")
+	}
+	return l.errorf(l.pos, "Unterminated quoted string")
+}
+
+// positional reports if the current position holds a positional parameter.
+func (l *lexer) positional() bool {
+	return !l.afterIdent() && l.pos+1 < len(l.src) && '0' <= l.src[l.pos+1] && l.src[l.pos+1] <= '9'
+}
+
+// paramName returns the name of the named parameter at the current position.
+// An empty string is returned if there is none.
+func (l *lexer) paramName() string {
+	if l.pos > 0 && (isIdent(l.src[l.pos-1]) || l.src[l.pos-1] == ':') {
+		// Array slice or type cast
+		return ""
+	}
+	if l.src[l.pos] == '@' && l.pos > 0 && isOperator(l.src[l.pos-1]) {
+		// Operator ending on @, like @@ or <@
+		return ""
+	}
+	i := l.pos + 1
+	if i >= len(l.src) || !isIdent(l.src[i]) || l.src[i] == '$' || ('0' <= l.src[i] && l.src[i] <= '9') {
+		return ""
+	}
+	for i < len(l.src) && isIdent(l.src[i]) && l.src[i] != '$' {
+		i++
+	}
+	return l.src[l.pos+1 : i]
+}
+
+// namedParam rewrites the named parameter at the current position
+// to its positional parameter.
+func (l *lexer) namedParam() {
+	name := l.paramName()
+	l.write("")
+	n := 0
+	for n < len(l.cur.params) && l.cur.params[n] != name {
+		n++
+	}
+	if n == len(l.cur.params) {
+		l.cur.params = append(l.cur.params, name)
+	}
+	l.write(fmt.Sprintf("$%d", n+1))
+	l.pos += len(name) + 1
+}
+
+// dollarTag returns the dollar quote tag at the current position,
+// including both dollar signs. An empty string is returned if there is none.
+func (l *lexer) dollarTag() string {
+	if l.afterIdent() {
+		// Dollar signs are allowed in identifiers
+		return ""
+	}
+	for i := l.pos + 1; i < len(l.src); i++ {
+		c := l.src[i]
+		switch {
+		case c == '$':
+			return l.src[l.pos : i+1]
+		case c >= '0' && c <= '9' && i == l.pos+1:
+			// Positional parameter, like $1
+			return ""
+		case !isIdent(c):
+			return ""
+		}
+	}
+	return ""
+}
+
+// dollarQuote writes the dollar quoted string at the current position verbatim,
+// up to and including the next occurrence of its opening tag.
+// Dollar quotes with another tag are part of the content.
+func (l *lexer) dollarQuote() error {
+	tag := l.dollarTag()
+	end := strings.Index(l.src[l.pos+len(tag):], tag)
+	if end < 0 {
+		return l.errorf(l.pos, "Unterminated dollar quoted string %s", tag)
+	}
+	end += l.pos + 2*len(tag)
+	l.write(l.src[l.pos:end])
+	l.pos = end
+	return nil
+}
+
+// isOperator reports if c may be part of an operator.
+func isOperator(c byte) bool {
+	return strings.IndexByte("+-*/<>=~!@#%^&|`?", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
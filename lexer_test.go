@@ -0,0 +1,238 @@
+package dotpgx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var lexTests = []struct {
+	name string
+	in   string
+	exp  []statement
+}{
+	{
+		"comment in string and identifier",
+		`select '--not a comment;' || "weird--col";`,
+		[]statement{{sql: `select '--not a comment;' || "weird--col";`}},
+	},
+	{
+		"escaped single quote",
+		`select 'it''s; -- fine' from t;`,
+		[]statement{{sql: `select 'it''s; -- fine' from t;`}},
+	},
+	{
+		"escape string",
+		`select E'back\'slash; --x', e'\\';`,
+		[]statement{{sql: `select E'back\'slash; --x', e'\\';`}},
+	},
+	{
+		"identifier ending on e",
+		"select type'x';",
+		[]statement{{sql: "select type'x';"}},
+	},
+	{
+		"escaped double quote",
+		`select "a""b;c" from "t--";`,
+		[]statement{{sql: `select "a""b;c" from "t--";`}},
+	},
+	{
+		"multi line string",
+		"select 'line1\n    line2;\n' -- comment\n    from t;",
+		[]statement{{sql: "select 'line1\n    line2;\n' from t;"}},
+	},
+	{
+		"inline block comment",
+		"select /* not; here */ 1;",
+		[]statement{{sql: "select 1;"}},
+	},
+	{
+		"nested block comment",
+		"/* outer /* inner; */ still; */ select 1;",
+		[]statement{{sql: "select 1;"}},
+	},
+	{
+		"block comment marker in string",
+		"select '/*', 1;",
+		[]statement{{sql: "select '/*', 1;"}},
+	},
+	{
+		"multiple statements per line",
+		"select 1; select 2;",
+		[]statement{{sql: "select 1;"}, {sql: "select 2;"}},
+	},
+	{
+		"whitespace collapse",
+		"select\t1,\n\n    2   from\r\n t;",
+		[]statement{{sql: "select 1, 2 from t;"}},
+	},
+	{
+		"name tags",
+		"-- name: one\nselect ';';\n--name:two\nselect 2\n",
+		[]statement{{name: "one", sql: "select ';';"}, {name: "two", sql: "select 2"}},
+	},
+	{
+		"name tag not on own line",
+		"select 1 -- name: nope\n;",
+		[]statement{{sql: "select 1 ;"}},
+	},
+	{
+		"dollar quote",
+		"do $$ begin\n    perform 1; -- comment\nend $$;",
+		[]statement{{sql: "do $$ begin\n    perform 1; -- comment\nend $$;"}},
+	},
+	{
+		"tagged dollar quote",
+		"create function f() returns int as $fn$\n    select 1;\n$fn$ language sql;",
+		[]statement{{sql: "create function f() returns int as $fn$\n    select 1;\n$fn$ language sql;"}},
+	},
+	{
+		"nested dollar quotes",
+		"do $outer$\nbegin\n    execute $$select 1;\n    -- kept\n$$;\nend\n$outer$;",
+		[]statement{{sql: "do $outer$\nbegin\n    execute $$select 1;\n    -- kept\n$$;\nend\n$outer$;"}},
+	},
+	{
+		"nested function bodies",
+		"do $a$ begin execute $e$ create function g() returns int as $$ select 1; $$ language sql $e$; end $a$;",
+		[]statement{{sql: "do $a$ begin execute $e$ create function g() returns int as $$ select 1; $$ language sql $e$; end $a$;"}},
+	},
+	{
+		"plpython function body",
+		"create function f() returns int as $$\n    # it's -- not a comment; /*\n    return 1\n$$ language plpython3u;",
+		[]statement{{sql: "create function f() returns int as $$\n    # it's -- not a comment; /*\n    return 1\n$$ language plpython3u;"}},
+	},
+	{
+		"plv8 function body",
+		"create function f() returns text as $js$\n    // don't; -- \"\n    return 'x';\n$js$ language plv8;",
+		[]statement{{sql: "create function f() returns text as $js$\n    // don't; -- \"\n    return 'x';\n$js$ language plv8;"}},
+	},
+	{
+		"dollar quotes on one line",
+		"select $$a;b$$, $$it's$$; select $t$ -- no comment; $t$;",
+		[]statement{{sql: "select $$a;b$$, $$it's$$;"}, {sql: "select $t$ -- no comment; $t$;"}},
+	},
+	{
+		"dollar signs that are no quotes",
+		"select $1, a$b$ from t; select 2;",
+		[]statement{{sql: "select $1, a$b$ from t;"}, {sql: "select 2;"}},
+	},
+	{
+		"named parameters",
+		"select :email, @name, :email from t where id = :id;",
+		[]statement{{sql: "select $1, $2, $1 from t where id = $3;", params: []string{"email", "name", "id"}}},
+	},
+	{
+		"no named parameters",
+		"select ':x', \":x\", x::int, a[lo:hi], a[1:2], b @> c, 'a'::text;",
+		[]statement{{sql: "select ':x', \":x\", x::int, a[lo:hi], a[1:2], b @> c, 'a'::text;"}},
+	},
+	{
+		"operators with @",
+		"select tsv @@plainto_tsquery(:q), tags <@array['x'], tags@>array[@tag], j @? '$.a', j@?'$.b', @ -1, x=@y;",
+		[]statement{{sql: "select tsv @@plainto_tsquery($1), tags <@array['x'], tags@>array[$2], j @? '$.a', j@?'$.b', @ -1, x=@y;", params: []string{"q", "tag"}}},
+	},
+	{
+		"named parameters in function body",
+		"do $$ declare x int := :y; begin end $$; select :x::int;",
+		[]statement{
+			{sql: "do $$ declare x int := :y; begin end $$;"},
+			{sql: "select $1::int;", params: []string{"x"}},
+		},
+	},
+	{
+		"annotations",
+		"-- doc: before\n-- name: one\n-- doc: after\nselect 1 -- mode: no\n-- mode: one\n;\n-- Note: no annotation\n-- tags: a\nselect 2;",
+		[]statement{
+			{name: "one", sql: "select 1 ;", ann: annotations{"doc": "before\nafter", "mode": "one"}},
+			{sql: "select 2;", ann: annotations{"tags": "a"}},
+		},
+	},
+}
+
+func TestLexSQL(t *testing.T) {
+	for _, lt := range lexTests {
+		got, err := lexSQL(strings.NewReader(lt.in), "")
+		if err != nil {
+			t.Fatal(lt.name, err)
+		}
+		// Positions are tested in TestLexPositions
+		for i := range got {
+			got[i].start, got[i].end = Position{}, Position{}
+		}
+		if !reflect.DeepEqual(lt.exp, got) {
+			t.Errorf("%s\nExpected:\n%+v\nGot:\n%+v", lt.name, lt.exp, got)
+		}
+	}
+}
+
+func TestLexPositions(t *testing.T) {
+	in := "-- name: one\nselect 'a\nb'\n  from t; select 2\n;\n/* c */ select\n3;\n"
+	exp := [][2]Position{
+		{{"f.sql", 1, 1}, {"f.sql", 4, 9}},
+		{{"f.sql", 4, 11}, {"f.sql", 5, 1}},
+		{{"f.sql", 6, 9}, {"f.sql", 7, 2}},
+	}
+	got, err := lexSQL(strings.NewReader(in), "f.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(exp) {
+		t.Fatal("Expected", len(exp), "statements, got", len(got))
+	}
+	for i, e := range exp {
+		if got[i].start != e[0] || got[i].end != e[1] {
+			t.Error(got[i].sql, "Expected:", e, "Got:", got[i].start, got[i].end)
+		}
+	}
+}
+
+func TestLexSQLErr(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp string
+	}{
+		{"select 'unterminated;", "f.sql:1:8: Unterminated quoted string"},
+		{"select\n  \"unterminated;", "f.sql:2:3: Unterminated quoted identifier"},
+		{"select E'unterminated\\';", "f.sql:1:9: Unterminated quoted string"},
+		{"select 1;\n/* unterminated /* */ select 1;", "f.sql:2:1: Unterminated block comment"},
+		{"select $a$ unterminated; $b$;", "f.sql:1:8: Unterminated dollar quoted string $a$"},
+		{"do $b$ begin end;", "f.sql:1:4: Unterminated dollar quoted string $b$"},
+		{"select 1;\n-- name: empty\n", "f.sql:2:1: Name tag without query body: empty"},
+		{"-- name: empty\n-- name: next\nselect 1;", "f.sql:1:1: Name tag without query body: empty"},
+		{"\n  select :a, $2;", "f.sql:2:3: Mixed named and positional parameters"},
+	}
+	for _, lt := range tests {
+		_, err := lexSQL(strings.NewReader(lt.in), "f.sql")
+		if _, ok := err.(*ParseError); !ok || err.Error() != lt.exp {
+			t.Errorf("%q\nExpected: %s\nGot: %v", lt.in, lt.exp, err)
+		}
+	}
+}
+
+func TestSplitSQL(t *testing.T) {
+	in := `-- name: second
+create table a (id int, ts timestamptz default now()::timestamptz);
+-- name: first
+-- doc: Not an annotation
+insert into a (id) values (1) on conflict do nothing;
+create function f() returns int as $$ select :x; $$ language sql;`
+	exp := []string{
+		"create table a (id int, ts timestamptz default now()::timestamptz);",
+		"insert into a (id) values (1) on conflict do nothing;",
+		"create function f() returns int as $$ select :x; $$ language sql;",
+	}
+	got, err := SplitSQL(strings.NewReader(in), "f.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Errorf("\nExpected: %q\nGot:      %q", exp, got)
+	}
+	// Named parameters are not rewritten
+	if got, _ = SplitSQL(strings.NewReader("select :a, $1, @b;"), ""); got[0] != "select :a, $1, @b;" {
+		t.Error("Unexpected statement:", got[0])
+	}
+	if _, err = SplitSQL(strings.NewReader("select 'unterminated;"), "f.sql"); err == nil || err.Error() != "f.sql:1:8: Unterminated quoted string" {
+		t.Error("Expected ParseError, got:", err)
+	}
+}
@@ -0,0 +1,81 @@
+package dotpgx
+
+import (
+	"log/slog"
+	"sort"
+
+	"github.com/jackc/pgx"
+)
+
+// Logger receives the log records of dotpgx and its connection pool.
+// Ctx holds alternating keys and values.
+// A *slog.Logger and a log15.Logger implement it as is.
+type Logger interface {
+	Debug(msg string, ctx ...interface{})
+	Info(msg string, ctx ...interface{})
+	Warn(msg string, ctx ...interface{})
+	Error(msg string, ctx ...interface{})
+}
+
+// NopLogger discards all records.
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, ctx ...interface{}) {}
+func (nopLogger) Info(msg string, ctx ...interface{})  {}
+func (nopLogger) Warn(msg string, ctx ...interface{})  {}
+func (nopLogger) Error(msg string, ctx ...interface{}) {}
+
+// SlogLogger returns a Logger that writes to l.
+// A nil l writes to slog.Default at the time of each record.
+func SlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		return defaultLogger{}
+	}
+	return l
+}
+
+// defaultLogger writes to slog.Default.
+type defaultLogger struct{}
+
+func (defaultLogger) Debug(msg string, ctx ...interface{}) { slog.Default().Debug(msg, ctx...) }
+func (defaultLogger) Info(msg string, ctx ...interface{})  { slog.Default().Info(msg, ctx...) }
+func (defaultLogger) Warn(msg string, ctx ...interface{})  { slog.Default().Warn(msg, ctx...) }
+func (defaultLogger) Error(msg string, ctx ...interface{}) { slog.Default().Error(msg, ctx...) }
+
+// log returns the Logger of db, the slog default logger if it is not set.
+func (db *DB) log() Logger {
+	if db.Logger == nil {
+		return defaultLogger{}
+	}
+	return db.Logger
+}
+
+// pgxLogger passes the records of pgx to the Logger of a DB.
+type pgxLogger struct {
+	db *DB
+}
+
+func (l pgxLogger) Log(level pgx.LogLevel, msg string, data map[string]interface{}) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ctx := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		ctx = append(ctx, k, data[k])
+	}
+	lg := l.db.log()
+	switch level {
+	case pgx.LogLevelError:
+		lg.Error(msg, ctx...)
+	case pgx.LogLevelWarn:
+		lg.Warn(msg, ctx...)
+	case pgx.LogLevelInfo:
+		lg.Info(msg, ctx...)
+	default:
+		lg.Debug(msg, ctx...)
+	}
+}
@@ -0,0 +1,103 @@
+package dotpgx
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+type logRecord struct {
+	level string
+	msg   string
+	ctx   map[string]interface{}
+}
+
+// recordLogger is a Logger that stores its records.
+type recordLogger struct {
+	records []logRecord
+}
+
+func (l *recordLogger) add(level, msg string, ctx []interface{}) {
+	m := make(map[string]interface{})
+	for i := 0; i+1 < len(ctx); i += 2 {
+		m[fmt.Sprint(ctx[i])] = ctx[i+1]
+	}
+	l.records = append(l.records, logRecord{level, msg, m})
+}
+
+func (l *recordLogger) Debug(msg string, ctx ...interface{}) { l.add("debug", msg, ctx) }
+func (l *recordLogger) Info(msg string, ctx ...interface{})  { l.add("info", msg, ctx) }
+func (l *recordLogger) Warn(msg string, ctx ...interface{})  { l.add("warn", msg, ctx) }
+func (l *recordLogger) Error(msg string, ctx ...interface{}) { l.add("error", msg, ctx) }
+
+func TestPgxLogger(t *testing.T) {
+	rec := new(recordLogger)
+	l := pgxLogger{&DB{Logger: rec}}
+	levels := map[pgx.LogLevel]string{
+		pgx.LogLevelTrace: "debug",
+		pgx.LogLevelDebug: "debug",
+		pgx.LogLevelInfo:  "info",
+		pgx.LogLevelWarn:  "warn",
+		pgx.LogLevelError: "error",
+	}
+	for level, exp := range levels {
+		rec.records = nil
+		l.Log(level, "Query", map[string]interface{}{"sql": "select 1", "args": []interface{}{}})
+		if len(rec.records) != 1 || rec.records[0].level != exp {
+			t.Error(level, "Expected:", exp, "Got:", rec.records)
+		}
+	}
+	exp := map[string]interface{}{"sql": "select 1", "args": []interface{}{}}
+	if !reflect.DeepEqual(rec.records[0].ctx, exp) {
+		t.Error("Expected:", exp, "Got:", rec.records[0].ctx)
+	}
+}
+
+func TestLoggers(t *testing.T) {
+	var buf bytes.Buffer
+	sl := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	SlogLogger(sl).Debug("Loaded sql", "queries", 2)
+	if got := buf.String(); !strings.Contains(got, `msg="Loaded sql" queries=2`) {
+		t.Error("Wrong slog output:", got)
+	}
+
+	buf.Reset()
+	l15 := log.New()
+	l15.SetHandler(log.StreamHandler(&buf, log.LogfmtFormat()))
+	// A log15.Logger is a Logger without an adapter
+	var lg Logger = l15
+	lg.Warn("Slow query", "query", "one")
+	if got := buf.String(); !strings.Contains(got, `msg="Slow query" query=one`) {
+		t.Error("Wrong log15 output:", got)
+	}
+
+	// The default logger writes to slog.Default
+	buf.Reset()
+	def := slog.Default()
+	defer slog.SetDefault(def)
+	slog.SetDefault(sl)
+	new(DB).log().Info("Default")
+	SlogLogger(nil).Info("Nil")
+	if got := buf.String(); !strings.Contains(got, "Default") || !strings.Contains(got, "Nil") {
+		t.Error("Wrong default output:", got)
+	}
+
+	NopLogger.Error("Discarded")
+}
+
+func TestParseLog(t *testing.T) {
+	rec := new(recordLogger)
+	cdb := &DB{Logger: rec}
+	if err := cdb.ParseSQL(strings.NewReader("-- name: one\nselect 1;")); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.records) != 1 || !reflect.DeepEqual(rec.records[0].ctx["queries"], []string{"one"}) {
+		t.Error("Parse not logged:", rec.records)
+	}
+}
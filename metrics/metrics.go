@@ -0,0 +1,112 @@
+/*
+Package metrics collects dotpgx query metrics and exposes them
+in the Prometheus text exposition format.
+
+A Collector is a dotpgx.Hook. It records per query name and operation:
+a latency histogram, whose count is the number of calls,
+errors by SQLSTATE class and the total rows affected by Exec.
+Transaction and batch operations are recorded with an empty query name.
+Errors of QueryRow are only recorded if they occur when sending the query,
+errors deferred until Scan, like pgx.ErrNoRows, are not, see dotpgx.Hook.
+The gauges of the connection pool are read from Pool.Stat on every scrape.
+
+	c := metrics.New(db)
+	http.Handle("/metrics", c)
+*/
+package metrics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/usrpro/dotpgx"
+)
+
+// DefaultBuckets are the upper bounds of the latency histograms, in seconds.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ClassOther is the error class of errors that are not a PostgreSQL error,
+// like connection and context errors.
+const ClassOther = "other"
+
+// Collector records the metrics of the queries of a DB.
+// It is safe for concurrent use.
+type Collector struct {
+	// Buckets are the sorted upper bounds of the latency histograms, in seconds.
+	// It must not be changed after the first query is recorded.
+	Buckets []float64
+
+	db     *dotpgx.DB
+	mu     sync.Mutex
+	series map[key]*series
+}
+
+type key struct {
+	op, query string
+}
+
+type series struct {
+	buckets []uint64 // Observations per bucket, not cumulative
+	count   uint64
+	sum     float64
+	errors  map[string]uint64 // By SQLSTATE class
+	rows    int64
+}
+
+// New returns a Collector with DefaultBuckets and adds it to the hooks of db.
+// Like all hooks, it must be added before db is used.
+func New(db *dotpgx.DB) *Collector {
+	c := &Collector{
+		Buckets: DefaultBuckets,
+		db:      db,
+		series:  make(map[key]*series),
+	}
+	db.Hooks = append(db.Hooks, c)
+	return c
+}
+
+// BeforeQuery implements dotpgx.Hook.
+func (c *Collector) BeforeQuery(ctx context.Context, ev dotpgx.QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery implements dotpgx.Hook, it records the event.
+func (c *Collector) AfterQuery(ctx context.Context, ev dotpgx.QueryEvent, err error) {
+	c.observe(ev.Op, ev.Name, ev.Duration, ev.RowsAffected, err)
+}
+
+func (c *Collector) observe(op, query string, d time.Duration, rows int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := key{op, query}
+	s := c.series[k]
+	if s == nil {
+		s = &series{
+			buckets: make([]uint64, len(c.Buckets)),
+			errors:  make(map[string]uint64),
+		}
+		c.series[k] = s
+	}
+	sec := d.Seconds()
+	if i := sort.SearchFloat64s(c.Buckets, sec); i < len(c.Buckets) {
+		s.buckets[i]++
+	}
+	s.count++
+	s.sum += sec
+	s.rows += rows
+	if err != nil {
+		s.errors[errClass(err)]++
+	}
+}
+
+// errClass returns the SQLSTATE class of err: the first two characters of the code.
+// ClassOther is returned if err is not a PostgreSQL error.
+func errClass(err error) string {
+	code := dotpgx.SQLState(err)
+	if len(code) < 2 {
+		return ClassOther
+	}
+	return code[:2]
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/usrpro/dotpgx"
+)
+
+func TestErrClass(t *testing.T) {
+	tests := map[error]string{
+		pgx.PgError{Code: "23505"}:                            "23",
+		&pgx.PgError{Code: "40001"}:                           "40",
+		fmt.Errorf("wrapped: %w", pgx.PgError{Code: "42P01"}): "42",
+		pgx.PgError{}:                                         ClassOther,
+		context.Canceled:                                      ClassOther,
+	}
+	for err, exp := range tests {
+		if got := errClass(err); got != exp {
+			t.Error(err, "Expected:", exp, "Got:", got)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	db := &dotpgx.DB{}
+	c := New(db)
+	if len(db.Hooks) != 1 || db.Hooks[0] != c {
+		t.Fatal("Collector not added to hooks")
+	}
+	c.Buckets = []float64{.01, .1}
+	c.AfterQuery(context.Background(), dotpgx.QueryEvent{
+		Op:           dotpgx.OpExec,
+		Name:         "one",
+		Duration:     5 * time.Millisecond,
+		RowsAffected: 2,
+	}, nil)
+	c.AfterQuery(context.Background(), dotpgx.QueryEvent{
+		Op:       dotpgx.OpExec,
+		Name:     "one",
+		Duration: time.Second,
+	}, pgx.PgError{Code: "23505"})
+
+	s := c.series[key{dotpgx.OpExec, "one"}]
+	if s == nil {
+		t.Fatal("Series not recorded")
+	}
+	if s.count != 2 || s.rows != 2 || s.errors["23"] != 1 {
+		t.Error("Wrong series:", s)
+	}
+	// The second observation exceeds all buckets
+	if s.buckets[0] != 1 || s.buckets[1] != 0 {
+		t.Error("Wrong buckets:", s.buckets)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	db, err := dotpgx.New(dotpgx.Default.ConnPoolConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	c := New(db)
+	if err = db.ParseSQL(strings.NewReader("-- name: one\nselect 1;\n-- name: fail\nselect 1/0;")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("one"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("fail"); err == nil {
+		t.Fatal("Expected division by zero error")
+	}
+
+	var b strings.Builder
+	if _, err = c.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, exp := range []string{
+		`dotpgx_query_duration_seconds_count{query="one",op="exec"} 1`,
+		`dotpgx_query_errors_total{query="fail",op="exec",class="22"} 1`,
+		`dotpgx_query_rows_affected_total{query="one",op="exec"} 1`,
+		"dotpgx_pool_max_connections ",
+		"dotpgx_pool_current_connections ",
+		"dotpgx_pool_available_connections ",
+	} {
+		if !strings.Contains(out, exp) {
+			t.Error("Missing", exp, "in:\n", out)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/usrpro/dotpgx"
+)
+
+// ContentType of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format to w.
+// Series are sorted by query name and operation.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	c.mu.Lock()
+	keys := make([]key, 0, len(c.series))
+	for k := range c.series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].query != keys[j].query {
+			return keys[i].query < keys[j].query
+		}
+		return keys[i].op < keys[j].op
+	})
+
+	header(&b, "dotpgx_query_duration_seconds", "histogram", "Duration of queries and transaction operations.")
+	for _, k := range keys {
+		s := c.series[k]
+		var cum uint64
+		for i, le := range c.Buckets {
+			cum += s.buckets[i]
+			sample(&b, "dotpgx_query_duration_seconds_bucket", labels(k, "le", formatFloat(le)), float64(cum))
+		}
+		sample(&b, "dotpgx_query_duration_seconds_bucket", labels(k, "le", "+Inf"), float64(s.count))
+		sample(&b, "dotpgx_query_duration_seconds_sum", labels(k), s.sum)
+		sample(&b, "dotpgx_query_duration_seconds_count", labels(k), float64(s.count))
+	}
+
+	header(&b, "dotpgx_query_errors_total", "counter", "Failed queries and transaction operations, by SQLSTATE class.")
+	for _, k := range keys {
+		s := c.series[k]
+		classes := make([]string, 0, len(s.errors))
+		for class := range s.errors {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			sample(&b, "dotpgx_query_errors_total", labels(k, "class", class), float64(s.errors[class]))
+		}
+	}
+
+	header(&b, "dotpgx_query_rows_affected_total", "counter", "Rows affected by Exec.")
+	for _, k := range keys {
+		if k.op == dotpgx.OpExec {
+			sample(&b, "dotpgx_query_rows_affected_total", labels(k), float64(c.series[k].rows))
+		}
+	}
+	c.mu.Unlock()
+
+	if c.db != nil && c.db.Pool != nil {
+		stat := c.db.Pool.Stat()
+		header(&b, "dotpgx_pool_max_connections", "gauge", "Maximum number of connections of the pool.")
+		sample(&b, "dotpgx_pool_max_connections", "", float64(stat.MaxConnections))
+		header(&b, "dotpgx_pool_current_connections", "gauge", "Current live connections of the pool.")
+		sample(&b, "dotpgx_pool_current_connections", "", float64(stat.CurrentConnections))
+		header(&b, "dotpgx_pool_available_connections", "gauge", "Unused live connections of the pool.")
+		sample(&b, "dotpgx_pool_available_connections", "", float64(stat.AvailableConnections))
+	}
+	return b.WriteTo(w)
+}
+
+func header(b *bytes.Buffer, name, typ, help string) {
+	b.WriteString("# HELP " + name + " " + help + "\n")
+	b.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func sample(b *bytes.Buffer, name, labels string, v float64) {
+	b.WriteString(name + labels + " " + formatFloat(v) + "\n")
+}
+
+// labels formats the labels of k and the extra name value pairs in kv.
+func labels(k key, kv ...string) string {
+	l := []string{
+		`query="` + escape(k.query) + `"`,
+		`op="` + escape(k.op) + `"`,
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		l = append(l, kv[i]+`="`+escape(kv[i+1])+`"`)
+	}
+	return "{" + strings.Join(l, ",") + "}"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape a label value.
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/usrpro/dotpgx"
+)
+
+func TestServeHTTP(t *testing.T) {
+	c := New(&dotpgx.DB{})
+	c.Buckets = []float64{.01, .1}
+	ctx := context.Background()
+	c.AfterQuery(ctx, dotpgx.QueryEvent{Op: dotpgx.OpExec, Name: "one", Duration: 5 * time.Millisecond, RowsAffected: 3}, nil)
+	c.AfterQuery(ctx, dotpgx.QueryEvent{Op: dotpgx.OpExec, Name: "one", Duration: 50 * time.Millisecond}, pgx.PgError{Code: "23505"})
+	c.AfterQuery(ctx, dotpgx.QueryEvent{Op: dotpgx.OpCommit, Duration: time.Second}, nil)
+	c.AfterQuery(ctx, dotpgx.QueryEvent{Op: dotpgx.OpQuery, Name: `q"1`, Duration: time.Millisecond}, context.Canceled)
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Error("Expected:", ContentType, "Got:", ct)
+	}
+	exp := `# HELP dotpgx_query_duration_seconds Duration of queries and transaction operations.
+# TYPE dotpgx_query_duration_seconds histogram
+dotpgx_query_duration_seconds_bucket{query="",op="commit",le="0.01"} 0
+dotpgx_query_duration_seconds_bucket{query="",op="commit",le="0.1"} 0
+dotpgx_query_duration_seconds_bucket{query="",op="commit",le="+Inf"} 1
+dotpgx_query_duration_seconds_sum{query="",op="commit"} 1
+dotpgx_query_duration_seconds_count{query="",op="commit"} 1
+dotpgx_query_duration_seconds_bucket{query="one",op="exec",le="0.01"} 1
+dotpgx_query_duration_seconds_bucket{query="one",op="exec",le="0.1"} 2
+dotpgx_query_duration_seconds_bucket{query="one",op="exec",le="+Inf"} 2
+dotpgx_query_duration_seconds_sum{query="one",op="exec"} 0.055
+dotpgx_query_duration_seconds_count{query="one",op="exec"} 2
+dotpgx_query_duration_seconds_bucket{query="q\"1",op="query",le="0.01"} 1
+dotpgx_query_duration_seconds_bucket{query="q\"1",op="query",le="0.1"} 1
+dotpgx_query_duration_seconds_bucket{query="q\"1",op="query",le="+Inf"} 1
+dotpgx_query_duration_seconds_sum{query="q\"1",op="query"} 0.001
+dotpgx_query_duration_seconds_count{query="q\"1",op="query"} 1
+# HELP dotpgx_query_errors_total Failed queries and transaction operations, by SQLSTATE class.
+# TYPE dotpgx_query_errors_total counter
+dotpgx_query_errors_total{query="one",op="exec",class="23"} 1
+dotpgx_query_errors_total{query="q\"1",op="query",class="other"} 1
+# HELP dotpgx_query_rows_affected_total Rows affected by Exec.
+# TYPE dotpgx_query_rows_affected_total counter
+dotpgx_query_rows_affected_total{query="one",op="exec"} 3
+`
+	if got := rec.Body.String(); got != exp {
+		t.Errorf("Expected:\n%s\nGot:\n%s", exp, got)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := map[float64]string{
+		0:            "0",
+		0.25:         "0.25",
+		1e-9:         "1e-09",
+		math.Inf(1):  "+Inf",
+		math.Inf(-1): "-Inf",
+	}
+	for v, exp := range tests {
+		if got := formatFloat(v); got != exp {
+			t.Error(v, "Expected:", exp, "Got:", got)
+		}
+	}
+}
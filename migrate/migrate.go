@@ -0,0 +1,403 @@
+/*
+Package migrate applies versioned SQL migrations using dotpgx.
+
+Migrations are loaded from files named like "0001_create_users.up.sql"
+and "0001_create_users.down.sql". The number is the version,
+the part after the underscore is the name. The down file is optional,
+but a migration without one cannot be rolled back.
+
+The statements in a migration file are split by dotpgx.SplitSQL
+and executed in source order, inside a single transaction.
+Named parameters and name tags are left alone, they have no meaning in migrations.
+Applied versions are recorded with a checksum of their up file
+in the schema_migrations table.
+Each transaction holds a PostgreSQL advisory lock, as does the creation
+of the table, so multiple processes can safely run the same migrations.
+*/
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/usrpro/dotpgx"
+)
+
+// DefaultTable is the default name of the table that records applied migrations.
+const DefaultTable = "schema_migrations"
+
+var fileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// ErrNoMigrations is returned by New when fsys contains no migration files.
+var ErrNoMigrations = errors.New("No migration files")
+
+// Migration is a single versioned migration.
+type Migration struct {
+	Version int64
+	Name    string
+	// Checksum is the hex encoded SHA-256 of the up file.
+	Checksum string
+
+	up, down []string // Statements, nil down if there is no down file
+}
+
+// Status of a migration, as reported by Migrator.Status.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the up file changed after the migration was applied.
+	Modified bool
+	// Missing is set for applied versions of which there is no migration file.
+	Missing bool
+}
+
+// Migrator applies migrations on a database.
+type Migrator struct {
+	// Table records the applied migrations. It defaults to DefaultTable.
+	Table      string
+	db         *dotpgx.DB
+	migrations []*Migration // Sorted by version
+}
+
+// New loads the migration files from the root of fsys.
+// Use os.DirFS or fs.Sub to load from a directory.
+// Files that do not match the migration file name pattern are ignored.
+func New(db *dotpgx.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	m := &Migrator{
+		Table: DefaultTable,
+		db:    db,
+	}
+	versions := make(map[int64]*Migration)
+	for _, e := range entries {
+		match := fileRegexp.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		mig := versions[version]
+		if mig == nil {
+			mig = &Migration{
+				Version: version,
+				Name:    match[2],
+			}
+			versions[version] = mig
+			m.migrations = append(m.migrations, mig)
+		} else if mig.Name != match[2] {
+			return nil, fmt.Errorf("Duplicate migration version %d: %s and %s", version, mig.Name, match[2])
+		}
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		stmts, err := dotpgx.SplitSQL(bytes.NewReader(b), e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if len(stmts) == 0 {
+			return nil, fmt.Errorf("%s: %w", e.Name(), dotpgx.ErrNothingParsed)
+		}
+		if match[3] == "up" {
+			sum := sha256.Sum256(b)
+			mig.Checksum = hex.EncodeToString(sum[:])
+			mig.up = stmts
+		} else {
+			mig.down = stmts
+		}
+	}
+	if len(m.migrations) == 0 {
+		return nil, ErrNoMigrations
+	}
+	for _, mig := range m.migrations {
+		if mig.up == nil {
+			return nil, fmt.Errorf("Missing up file for migration %d_%s", mig.Version, mig.Name)
+		}
+	}
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+	return m, nil
+}
+
+// Migrations returns the loaded migrations, sorted by version.
+func (m *Migrator) Migrations() []*Migration {
+	return append([]*Migration(nil), m.migrations...)
+}
+
+// applied is a row of the migrations table.
+type applied struct {
+	checksum string
+	at       time.Time
+}
+
+// init creates the migrations table if it does not exist,
+// holding the advisory lock, as concurrent creation of a table can fail.
+func (m *Migrator) init(ctx context.Context) error {
+	tx, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecEx(ctx, fmt.Sprintf(`create table if not exists %s (
+		version bigint primary key,
+		name varchar not null,
+		checksum varchar not null,
+		applied_at timestamptz not null default now()
+	)`, pgx.Identifier{m.Table}.Sanitize()), nil)
+	if err != nil {
+		return err
+	}
+	return tx.CommitEx(ctx)
+}
+
+// lock begins a transaction holding the advisory lock.
+func (m *Migrator) lock(ctx context.Context) (*pgx.Tx, error) {
+	tx, err := m.db.Pool.BeginEx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.ExecEx(ctx, "select pg_advisory_xact_lock($1)", nil, m.lockKey()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// lockKey is the advisory lock key, derived from the table name.
+func (m *Migrator) lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("dotpgx/migrate:" + m.Table))
+	return int64(h.Sum64())
+}
+
+type querier interface {
+	QueryEx(ctx context.Context, sql string, options *pgx.QueryExOptions, args ...interface{}) (*pgx.Rows, error)
+}
+
+func (m *Migrator) applied(ctx context.Context, q querier) (map[int64]applied, error) {
+	rows, err := q.QueryEx(ctx, fmt.Sprintf(
+		"select version, checksum, applied_at from %s", pgx.Identifier{m.Table}.Sanitize(),
+	), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	am := make(map[int64]applied)
+	for rows.Next() {
+		var v int64
+		var a applied
+		if err = rows.Scan(&v, &a.checksum, &a.at); err != nil {
+			return nil, err
+		}
+		am[v] = a
+	}
+	return am, rows.Err()
+}
+
+// Status returns the status of all migrations, sorted by version.
+// Applied versions without a migration file are included as Missing.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.init(ctx); err != nil {
+		return nil, err
+	}
+	am, err := m.applied(ctx, m.db.Pool)
+	if err != nil {
+		return nil, err
+	}
+	var status []Status
+	for _, mig := range m.migrations {
+		s := Status{
+			Version: mig.Version,
+			Name:    mig.Name,
+		}
+		if a, ok := am[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.at
+			s.Modified = a.checksum != mig.Checksum
+			delete(am, mig.Version)
+		}
+		status = append(status, s)
+	}
+	for v, a := range am {
+		status = append(status, Status{
+			Version:   v,
+			Applied:   true,
+			AppliedAt: a.at,
+			Missing:   true,
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.up(ctx, -1)
+}
+
+// Down rolls back the last n applied migrations.
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(status) - 1; i >= 0 && n > 0; i-- {
+		if !status[i].Applied {
+			continue
+		}
+		if err = m.down(ctx, status[i]); err != nil {
+			return err
+		}
+		n--
+	}
+	return nil
+}
+
+// To migrates up or down to version.
+// Migrations up to and including version get applied,
+// applied migrations above version get rolled back.
+// Version 0 rolls back all migrations.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if err := m.up(ctx, version); err != nil {
+		return err
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(status) - 1; i >= 0 && status[i].Version > version; i-- {
+		if !status[i].Applied {
+			continue
+		}
+		if err = m.down(ctx, status[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// up applies pending migrations up to and including version.
+// A negative version applies all pending migrations.
+func (m *Migrator) up(ctx context.Context, version int64) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range status {
+		if s.Modified {
+			return fmt.Errorf("Migration %d_%s was modified after it was applied", s.Version, s.Name)
+		}
+	}
+	for _, mig := range m.migrations {
+		if version >= 0 && mig.Version > version {
+			break
+		}
+		if err = m.apply(ctx, mig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exec runs stmts in order inside a transaction holding the advisory lock.
+// Before runs first; if it returns false, the transaction is rolled back without further action.
+// After runs when all statements are executed.
+func (m *Migrator) exec(ctx context.Context, stmts []string, before func(*pgx.Tx) (bool, error), after func(*pgx.Tx) error) error {
+	tx, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	ok, err := before(tx)
+	if err != nil || !ok {
+		return err
+	}
+	for _, sql := range stmts {
+		if _, err = tx.ExecEx(ctx, sql, nil); err != nil {
+			return err
+		}
+	}
+	if err = after(tx); err != nil {
+		return err
+	}
+	return tx.CommitEx(ctx)
+}
+
+// apply a migration, unless it got applied in the mean time.
+func (m *Migrator) apply(ctx context.Context, mig *Migration) error {
+	table := pgx.Identifier{m.Table}.Sanitize()
+	err := m.exec(ctx, mig.up,
+		func(tx *pgx.Tx) (bool, error) {
+			am, err := m.applied(ctx, tx)
+			if err != nil {
+				return false, err
+			}
+			_, done := am[mig.Version]
+			return !done, nil
+		},
+		func(tx *pgx.Tx) error {
+			_, err := tx.ExecEx(ctx,
+				fmt.Sprintf("insert into %s (version, name, checksum) values ($1, $2, $3)", table),
+				nil, mig.Version, mig.Name, mig.Checksum,
+			)
+			return err
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("Migration %d_%s up: %w", mig.Version, mig.Name, err)
+	}
+	return nil
+}
+
+// down rolls back an applied migration, unless it got rolled back in the mean time.
+func (m *Migrator) down(ctx context.Context, s Status) error {
+	var mig *Migration
+	for _, mm := range m.migrations {
+		if mm.Version == s.Version {
+			mig = mm
+		}
+	}
+	if mig == nil || mig.down == nil {
+		return fmt.Errorf("No down file for migration %d_%s", s.Version, s.Name)
+	}
+	table := pgx.Identifier{m.Table}.Sanitize()
+	err := m.exec(ctx, mig.down,
+		func(tx *pgx.Tx) (bool, error) {
+			am, err := m.applied(ctx, tx)
+			if err != nil {
+				return false, err
+			}
+			_, done := am[mig.Version]
+			return done, nil
+		},
+		func(tx *pgx.Tx) error {
+			_, err := tx.ExecEx(ctx, fmt.Sprintf("delete from %s where version = $1", table), nil, mig.Version)
+			return err
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("Migration %d_%s down: %w", mig.Version, mig.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/usrpro/dotpgx"
+)
+
+var testFS = fstest.MapFS{
+	"0001_create_migrate_a.up.sql": {Data: []byte(
+		"create table migrate_a (id int);\ninsert into migrate_a values (1);",
+	)},
+	"0001_create_migrate_a.down.sql": {Data: []byte("drop table migrate_a;")},
+	"0002_create_migrate_b.up.sql":   {Data: []byte("create table migrate_b (id int);")},
+	"0002_create_migrate_b.down.sql": {Data: []byte("drop table migrate_b;")},
+	"0010_alter_migrate_b.up.sql":    {Data: []byte("alter table migrate_b add column name text;")},
+	"0010_alter_migrate_b.down.sql":  {Data: []byte("alter table migrate_b drop column name;")},
+	"README.md":                      {Data: []byte("Not a migration")},
+}
+
+func TestNew(t *testing.T) {
+	m, err := New(&dotpgx.DB{}, testFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int64
+	for _, mig := range m.Migrations() {
+		got = append(got, mig.Version)
+		if mig.Checksum == "" || mig.up == nil || mig.down == nil {
+			t.Error("Incomplete migration", mig)
+		}
+	}
+	if exp := []int64{1, 2, 10}; !reflect.DeepEqual(exp, got) {
+		t.Error("\nExpected:\n", exp, "\nGot:\n", got)
+	}
+	if exp := []string{"create table migrate_a (id int);", "insert into migrate_a values (1);"}; !reflect.DeepEqual(exp, m.migrations[0].up) {
+		t.Error("\nExpected:\n", exp, "\nGot:\n", m.migrations[0].up)
+	}
+	// Statements run in source order, named parameters and tags are left alone
+	m, err = New(&dotpgx.DB{}, fstest.MapFS{"0001_a.up.sql": {Data: []byte(
+		"-- name: b\ncreate table b (id int);\n-- name: a\nalter table b add column ts timestamptz default now()::timestamptz;",
+	)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"create table b (id int);", "alter table b add column ts timestamptz default now()::timestamptz;"}
+	if got := m.migrations[0].up; !reflect.DeepEqual(exp, got) {
+		t.Error("\nExpected:\n", exp, "\nGot:\n", got)
+	}
+	// Function bodies in other languages are kept as-is
+	py := "create function py() returns int as $$\n    # it's -- one;\n    return 1\n$$ language plpython3u;"
+	js := "create function js() returns text as $js$\n    // don't; /* -- */\n    return 'x';\n$js$ language plv8;"
+	m, err = New(&dotpgx.DB{}, fstest.MapFS{"0001_a.up.sql": {Data: []byte(py + "\n" + js)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{py, js}; !reflect.DeepEqual(exp, m.migrations[0].up) {
+		t.Error("\nExpected:\n", exp, "\nGot:\n", m.migrations[0].up)
+	}
+
+	if _, err = New(&dotpgx.DB{}, fstest.MapFS{}); !errors.Is(err, ErrNoMigrations) {
+		t.Error("Expected ErrNoMigrations, got:", err)
+	}
+	bad := []fstest.MapFS{
+		{"0001_a.down.sql": {Data: []byte("select 1;")}},
+		{
+			"0001_a.up.sql": {Data: []byte("select 1;")},
+			"0001_b.up.sql": {Data: []byte("select 1;")},
+		},
+		{"0001_a.up.sql": {Data: []byte("select 'unterminated;")}},
+		{"0001_a.up.sql": {Data: []byte("-- Only a comment")}},
+	}
+	for _, fsys := range bad {
+		if _, err = New(&dotpgx.DB{}, fsys); err == nil {
+			t.Error("No error for", fsys)
+		}
+	}
+}
+
+func appliedVersions(t *testing.T, m *Migrator) (versions []int64) {
+	status, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.Applied {
+			versions = append(versions, s.Version)
+		}
+	}
+	return
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := dotpgx.New(dotpgx.Default.ConnPoolConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := New(db, testFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Table = "migrate_test_migrations"
+	defer db.Pool.Exec("drop table if exists migrate_test_migrations, migrate_a, migrate_b")
+
+	ctx := context.Background()
+	tests := []struct {
+		run func() error
+		exp []int64
+	}{
+		{func() error { return m.Up(ctx) }, []int64{1, 2, 10}},
+		{func() error { return m.Up(ctx) }, []int64{1, 2, 10}},
+		{func() error { return m.Down(ctx, 2) }, []int64{1}},
+		{func() error { return m.To(ctx, 2) }, []int64{1, 2}},
+		{func() error { return m.To(ctx, 10) }, []int64{1, 2, 10}},
+		{func() error { return m.To(ctx, 1) }, []int64{1}},
+		{func() error { return m.To(ctx, 0) }, nil},
+		{func() error { return m.To(ctx, 2) }, []int64{1, 2}},
+	}
+	for i, tt := range tests {
+		if err := tt.run(); err != nil {
+			t.Fatal(i, err)
+		}
+		if got := appliedVersions(t, m); !reflect.DeepEqual(tt.exp, got) {
+			t.Error(i, "\nExpected:\n", tt.exp, "\nGot:\n", got)
+		}
+	}
+	var n int
+	if err = db.Pool.QueryRow("select count(*) from migrate_a").Scan(&n); err != nil || n != 1 {
+		t.Error("Expected 1 row in migrate_a, got:", n, err)
+	}
+
+	// A failing migration is rolled back as a whole
+	failing := fstest.MapFS{}
+	for k, v := range testFS {
+		failing[k] = v
+	}
+	failing["0011_fail.up.sql"] = &fstest.MapFile{Data: []byte(
+		"create table migrate_c (id int);\nselect * from migrate_missing;",
+	)}
+	fm, err := New(db, failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm.Table = m.Table
+	if err = fm.Up(ctx); err == nil {
+		t.Fatal("Expected error from failing migration")
+	}
+	if got, exp := appliedVersions(t, fm), []int64{1, 2, 10}; !reflect.DeepEqual(exp, got) {
+		t.Error("\nExpected:\n", exp, "\nGot:\n", got)
+	}
+	if _, err = db.Pool.Exec("select * from migrate_c"); err == nil {
+		t.Error("Failed migration not rolled back")
+	}
+
+	// Modified migrations are reported and block Up
+	modified := fstest.MapFS{}
+	for k, v := range testFS {
+		modified[k] = v
+	}
+	modified["0002_create_migrate_b.up.sql"] = &fstest.MapFile{Data: []byte("create table migrate_b (id bigint);")}
+	mm, err := New(db, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mm.Table = m.Table
+	status, err := mm.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status[1].Modified || status[0].Modified {
+		t.Error("Wrong modified status:", status)
+	}
+	if err = mm.Up(ctx); err == nil {
+		t.Error("Expected error for modified migration")
+	}
+	if err = m.To(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConcurrentInit(t *testing.T) {
+	db, err := dotpgx.New(dotpgx.Default.ConnPoolConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := New(db, testFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Table = "migrate_init_migrations"
+	defer db.Pool.Exec("drop table if exists migrate_init_migrations")
+
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := m.Status(context.Background())
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
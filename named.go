@@ -0,0 +1,143 @@
+package dotpgx
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx"
+)
+
+// bind returns the positional arguments for the named parameters of the query.
+// Arg should be a map[string]interface{}, or a struct or pointer to a struct.
+// Struct fields are matched by their "db" tag or snake_cased field name.
+func (q *query) bind(arg interface{}) ([]interface{}, error) {
+	if m, ok := arg.(map[string]interface{}); ok {
+		args := make([]interface{}, len(q.params))
+		for i, p := range q.params {
+			v, ok := m[p]
+			if !ok {
+				return nil, errors.New(strings.Join([]string{"Missing named parameter", p}, ": "))
+			}
+			args[i] = v
+		}
+		return args, nil
+	}
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errors.New("Named arguments should be a map[string]interface{} or struct")
+	}
+	fi := fieldIndex(v.Type())
+	args := make([]interface{}, len(q.params))
+	for i, p := range q.params {
+		index, ok := fi[p]
+		if !ok {
+			return nil, errors.New(strings.Join([]string{"Missing named parameter", p}, ": "))
+		}
+		if f, ok := fieldValue(v, index); ok {
+			args[i] = f.Interface()
+		}
+	}
+	return args, nil
+}
+
+// bind looks up the query identified by name and binds the named arguments.
+func (qm queryMap) bind(name string, arg interface{}) ([]interface{}, error) {
+	q, err := qm.getQuery(name)
+	if err != nil {
+		return nil, err
+	}
+	return q.bind(arg)
+}
+
+// QueryNamed runs the sql identified by name, with arguments bound by name.
+// Arg should be a map[string]interface{}, or a struct or pointer to a struct.
+// Struct fields are matched by their "db" tag or snake_cased field name.
+func (db *DB) QueryNamed(name string, arg interface{}) (*pgx.Rows, error) {
+	return db.QueryNamedContext(context.Background(), name, arg)
+}
+
+// QueryNamedContext is like QueryNamed, but the query is cancelled when the context is done.
+func (db *DB) QueryNamedContext(ctx context.Context, name string, arg interface{}) (*pgx.Rows, error) {
+	args, err := db.reg.queries().bind(name, arg)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryContext(ctx, name, args...)
+}
+
+// QueryRowNamed runs the sql identified by name, with arguments bound by name.
+// It returns a single row.
+func (db *DB) QueryRowNamed(name string, arg interface{}) (*pgx.Row, error) {
+	return db.QueryRowNamedContext(context.Background(), name, arg)
+}
+
+// QueryRowNamedContext is like QueryRowNamed, but the query is cancelled when the context is done.
+func (db *DB) QueryRowNamedContext(ctx context.Context, name string, arg interface{}) (*pgx.Row, error) {
+	args, err := db.reg.queries().bind(name, arg)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryRowContext(ctx, name, args...)
+}
+
+// ExecNamed runs the sql identified by name, with arguments bound by name.
+func (db *DB) ExecNamed(name string, arg interface{}) (pgx.CommandTag, error) {
+	return db.ExecNamedContext(context.Background(), name, arg)
+}
+
+// ExecNamedContext is like ExecNamed, but the query is cancelled when the context is done.
+func (db *DB) ExecNamedContext(ctx context.Context, name string, arg interface{}) (pgx.CommandTag, error) {
+	args, err := db.reg.queries().bind(name, arg)
+	if err != nil {
+		return "", err
+	}
+	return db.ExecContext(ctx, name, args...)
+}
+
+// QueryNamed runs the sql identified by name, with arguments bound by name.
+func (tx *Tx) QueryNamed(name string, arg interface{}) (*pgx.Rows, error) {
+	return tx.QueryNamedContext(context.Background(), name, arg)
+}
+
+// QueryNamedContext is like QueryNamed, but the query is cancelled when the context is done.
+func (tx *Tx) QueryNamedContext(ctx context.Context, name string, arg interface{}) (*pgx.Rows, error) {
+	args, err := tx.reg.queries().bind(name, arg)
+	if err != nil {
+		return nil, err
+	}
+	return tx.QueryContext(ctx, name, args...)
+}
+
+// QueryRowNamed runs the sql identified by name, with arguments bound by name.
+// It returns a single row.
+func (tx *Tx) QueryRowNamed(name string, arg interface{}) (*pgx.Row, error) {
+	return tx.QueryRowNamedContext(context.Background(), name, arg)
+}
+
+// QueryRowNamedContext is like QueryRowNamed, but the query is cancelled when the context is done.
+func (tx *Tx) QueryRowNamedContext(ctx context.Context, name string, arg interface{}) (*pgx.Row, error) {
+	args, err := tx.reg.queries().bind(name, arg)
+	if err != nil {
+		return nil, err
+	}
+	return tx.QueryRowContext(ctx, name, args...)
+}
+
+// ExecNamed runs the sql identified by name, with arguments bound by name.
+func (tx *Tx) ExecNamed(name string, arg interface{}) (pgx.CommandTag, error) {
+	return tx.ExecNamedContext(context.Background(), name, arg)
+}
+
+// ExecNamedContext is like ExecNamed, but the query is cancelled when the context is done.
+func (tx *Tx) ExecNamedContext(ctx context.Context, name string, arg interface{}) (pgx.CommandTag, error) {
+	args, err := tx.reg.queries().bind(name, arg)
+	if err != nil {
+		return "", err
+	}
+	return tx.ExecContext(ctx, name, args...)
+}
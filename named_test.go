@@ -0,0 +1,91 @@
+package dotpgx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBind(t *testing.T) {
+	db := new(DB)
+	db.reg.clear()
+	r := strings.NewReader("--name: named\nselect :id, :full_name, :email, :id;")
+	if err := db.ParseSQL(r); err != nil {
+		t.Fatal(err)
+	}
+	exp := []interface{}{1, "Foo Bar", "foo@bar.com"}
+	got, err := db.reg.queries().bind("named", map[string]interface{}{
+		"id":        1,
+		"full_name": "Foo Bar",
+		"email":     "foo@bar.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatal("\nExpected:\n", exp, "\nGot:\n", got)
+	}
+	arg := &withBase{
+		base: &base{ID: 1, Email: "not@used.com"},
+		Name: "Foo Bar",
+	}
+	arg.Email = "foo@bar.com"
+	if got, err = db.reg.queries().bind("named", arg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatal("\nExpected:\n", exp, "\nGot:\n", got)
+	}
+
+	if _, err = db.reg.queries().bind("named", map[string]interface{}{"id": 1}); err == nil {
+		t.Error("Expected error for missing parameter")
+	}
+	if _, err = db.reg.queries().bind("named", struct{ ID int }{1}); err == nil {
+		t.Error("Expected error for missing field")
+	}
+	if _, err = db.reg.queries().bind("named", 1); err == nil {
+		t.Error("Expected error for unsupported argument type")
+	}
+	if _, err = db.reg.queries().bind("none", nil); err == nil {
+		t.Error("Expected error for unknown query")
+	}
+}
+
+func TestQueryNamed(t *testing.T) {
+	p := struct {
+		Name  string
+		Email string
+	}{"Named Peer", "named@peer.com"}
+	if _, err := db.ExecNamed("create-peer-named", p); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.QueryNamed("find-peers-by-email-named", map[string]interface{}{"email": p.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := rowScan(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []peer{{p.Name, p.Email}}
+	if msg := comparePeers(exp, got); msg != nil {
+		t.Fatal(msg...)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	row, err := tx.QueryRowNamed("find-peers-by-email-named", &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gp peer
+	if err = row.Scan(&gp.name, &gp.email); err != nil {
+		t.Fatal(err)
+	}
+	if !comparePeer(exp[0], gp) {
+		t.Fatal("\nExpected:\n", exp[0], "\nGot:\n", gp)
+	}
+}
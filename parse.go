@@ -1,28 +1,38 @@
 package dotpgx
 
 import (
-	"bufio"
-	"errors"
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
-	"sync"
 
 	"github.com/jackc/pgx"
 )
 
 type query struct {
-	sql string
-	ps  *pgx.PreparedStatement
+	sql    string
+	params []string // Named parameters, in positional order
+	ann    annotations
+	start  Position               // Position of the name tag, or the first token if unnamed
+	end    Position               // Position of the last token
+	ps     *pgx.PreparedStatement // Prepared on all connections of the pool
+	gen    int                    // Registry generation at which ps was prepared
 }
 
 func (q *query) isPrepared() bool {
 	return q != nil && q.ps != nil
 }
 
+// wrap err in a QueryError with the source position and name of the query.
+func (q *query) wrap(name string, err error) error {
+	return &QueryError{Name: name, Pos: q.start, Err: err}
+}
+
 func (q *query) getSQL() string {
 	if q.isPrepared() {
 		return q.ps.Name
@@ -47,8 +57,7 @@ func merge(maps ...queryMap) (qm queryMap) {
 
 func (qm queryMap) getQuery(name string) (*query, error) {
 	if qm[name] == nil {
-		s := []string{"Unknown query", name}
-		return nil, errors.New(strings.Join(s, ": "))
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQuery, name)
 	}
 	return qm[name], nil
 }
@@ -61,118 +70,142 @@ func (qm queryMap) sort() (index []string) {
 	return
 }
 
-var mutex = &sync.Mutex{}
-
 // ParseSQL parses and stores SQL queries from a io.Reader.
 // Queries should end with a semi-colon.
 // It stores queries by their "--name: <name>" tag.
 // If no name tag is specified, an incremental number will be appointed.
 // This might come in handy for sequential execution (like migrations).ParseSql
 // Parsed queries get appended to the current map.
-// If a name tag was already present, it will get overwritten by the new one parsed.
+// By default, a name tag that is already present results in a *DuplicateError.
+// If db.Duplicates is set to DuplicateOverride, the existing query
+// will get overwritten by the new one parsed instead.
 // The serial value is stored inside the DB object,
 // so it is safe to call this function multiple times.
 //
-// If the input conains a double dollar sign "$$", the parser will ignore semi-colon
-// untill another occurance of "$$". This makes parsing of functions possible.
+// Comments and semi-colons inside single quoted strings (including E'...' escape strings)
+// and double quoted identifiers are left untouched.
+// The contents of strings and identifiers are stored as-is,
+// anywhere else comments are removed and whitespace is collapsed into single spaces.
+//
+// If the input contains a dollar quote like "$$" or "$body$" after AS or DO,
+// the parser will ignore semi-colons untill the matching closing tag.
+// This makes parsing of functions and DO blocks possible.
+// Other dollar quoted strings are stored as-is.
+//
+// Queries may use named parameters like ":email" or "@email" instead of "$1".
+// They get rewritten to positional parameters in order of first appearance.
+// Use the *Named methods to bind arguments by name.
+//
+// Comment lines like "-- doc: Finds peers" or "-- tags: reporting,slow"
+// are annotations of the query that follows. See Describe and QueryInfo.
+//
+// Syntax errors, like unterminated strings or comments, are returned as *ParseError.
 func (db *DB) ParseSQL(r io.Reader) error {
-	sc := bufio.NewScanner(r)
-	comment := false
-	var tag string
-	var function bool
-	qm := make(queryMap)
-	for sc.Scan() {
-		// Read the line
-		line := sc.Text()
-		if err := sc.Err(); err != nil {
-			return err
-		}
-		// Sanetize leading and trailing whitespace
-		line = strings.TrimSpace(line)
-		// Line with name tag?
-		if strings.HasPrefix(line, "-- name:") || strings.HasPrefix(line, "--name:") {
-			tag = strings.TrimSpace(strings.Split(line, ":")[1])
-			// Initialise to empty query body, overwites any previous query with the same name
-			if err := db.DropQuery(tag); err != nil {
-				return err
-			}
-			qm[tag] = &query{}
-			continue
-		}
-		// Skip empty and comment lines
-		if len(line) == 0 || strings.HasPrefix(line, "--") {
-			continue
+	return db.parseSQL(r, "")
+}
+
+// parseSQL implements ParseSQL. File is recorded as the source of the queries.
+// In PrepareEager mode, the parsed queries get prepared.
+func (db *DB) parseSQL(r io.Reader, file string) error {
+	var names []string
+	replaced := make(queryMap)
+	db.reg.stmts.Lock()
+	err := db.reg.update(func(qm queryMap, qn int) (queryMap, int, error) {
+		parsed, qn, err := db.parse(r, file, qm, qn)
+		if err != nil {
+			return nil, qn, err
 		}
-		// Still inside comment block?
-		if comment {
-			if strings.HasSuffix(line, "*/") {
-				comment = false
+		names = parsed.sort()
+		for tag := range parsed {
+			if qm[tag] != nil {
+				replaced[tag] = qm[tag]
 			}
-			continue
 		}
-		// Beginning of comment block?
-		if strings.HasPrefix(line, "/*") {
-			comment = true
-			continue
+		return merge(qm, parsed), qn, nil
+	})
+	if err != nil {
+		db.reg.stmts.Unlock()
+		return err
+	}
+	db.log().Debug("Parsed sql", "file", file, "queries", names)
+	// The overwritten queries are deallocated once the new ones are in place,
+	// so readers can no longer resolve to their statements.
+	var errs MultiError
+	if err = db.deallocate(replaced); err != nil {
+		errs = append(errs, err)
+	}
+	db.reg.stmts.Unlock()
+	if db.PrepareMode == PrepareEager && db.Pool != nil {
+		if err = db.prepareNames(context.Background(), names); err != nil {
+			errs = append(errs, err)
 		}
-		// Not in comment block and no tag set?
+	}
+	return errs.err()
+}
+
+// parse returns the queries from r, without storing them.
+// Existing holds the queries checked for duplicate names.
+// Unnamed queries are numbered starting at qn, the next number is returned.
+func (db *DB) parse(r io.Reader, file string, existing queryMap, qn int) (queryMap, int, error) {
+	stmts, err := lexSQL(r, file)
+	if err != nil {
+		return nil, qn, err
+	}
+	qm := make(queryMap)
+	for _, s := range stmts {
+		tag := s.name
 		if len(tag) == 0 {
 			// Default to an auto-incremented tag number.
-			tag = fmt.Sprintf("%06d", db.qn)
-			db.qn++
-			qm[tag] = &query{}
-		}
-		// Inside of query body?
-		if len(tag) > 0 {
-			// Cut away inline comments
-			sql := strings.TrimSpace(strings.Split(line, "--")[0])
-			if len(qm[tag].sql) == 0 {
-				qm[tag].sql = sql
-			} else {
-				// Join with the existing body
-				j := []string{qm[tag].sql, sql}
-				qm[tag].sql = strings.Join(j, " ")
+			tag = fmt.Sprintf("%06d", qn)
+			qn++
+		} else if db.Duplicates != DuplicateOverride {
+			prev := qm[tag]
+			if prev == nil {
+				prev = existing[tag]
 			}
-
-			if function {
-				// End of function body?
-				if strings.Contains(sql, "$$") {
-					function = false
-				}
-			} else {
-				// Start of function body?
-				if strings.Contains(sql, "$$") {
-					function = true
+			if prev != nil {
+				return nil, qn, &DuplicateError{
+					Name:   tag,
+					First:  prev.start,
+					Second: s.start,
 				}
 			}
-
-			// End of query body reached? (not in function body)
-			if strings.HasSuffix(line, ";") && !function {
-				tag = ""
+		}
+		if err := s.ann.validate(); err != nil {
+			return nil, qn, &ParseError{
+				Pos: s.start,
+				Msg: err.Error(),
 			}
-			continue
+		}
+		qm[tag] = &query{
+			sql:    s.sql,
+			params: s.params,
+			ann:    s.ann,
+			start:  s.start,
+			end:    s.end,
 		}
 	}
 	if len(qm) == 0 {
-		return errors.New("Nothing parsed")
+		return nil, qn, &ParseError{
+			Pos: Position{File: file},
+			Msg: ErrNothingParsed.Error(),
+			Err: ErrNothingParsed,
+		}
 	}
-	mutex.Lock()
-	db.qm = merge(db.qm, qm)
-	mutex.Unlock()
-	return nil
+	return qm, qn, nil
 }
 
 // ParseFiles opens one or more files and feeds them to ParseSql
 func (db *DB) ParseFiles(files ...string) error {
 	if len(files) == 0 {
-		return errors.New("No files to parse")
+		return ErrNoFiles
 	}
 	for _, v := range files {
 		f, err := os.Open(v)
 		if err != nil {
 			return err
 		}
-		err = db.ParseSQL(f)
+		err = db.parseSQL(f, v)
 		f.Close()
 		if err != nil {
 			return err
@@ -201,3 +234,53 @@ func (db *DB) ParsePath(path string) error {
 	}
 	return db.ParseFileGlob(strings.Join(s, "/"))
 }
+
+// ParseFS parses the files in fsys that match one or more glob patterns.
+// See fs.Glob for the pattern syntax.
+// Matched directories are walked recursively and all .sql files in them are parsed.
+// Without patterns, all .sql files in fsys are parsed.
+// This allows parsing queries embedded in the binary through an embed.FS.
+func (db *DB) ParseFS(fsys fs.FS, patterns ...string) error {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	var files []string
+	for _, p := range patterns {
+		matches, err := fs.Glob(fsys, p)
+		if err != nil {
+			return err
+		}
+		for _, m := range matches {
+			err = fs.WalkDir(fsys, m, func(name string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if name == m && !d.IsDir() {
+					// Explicitly matched files are parsed regardless of their extension
+					files = append(files, name)
+				} else if !d.IsDir() && path.Ext(name) == ".sql" {
+					files = append(files, name)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(files) == 0 {
+		return ErrNoFiles
+	}
+	for _, name := range files {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		err = db.parseSQL(f, name)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
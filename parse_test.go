@@ -1,8 +1,11 @@
 package dotpgx
 
 import (
+	"context"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 const parseFile = "tests/parse.sql"
@@ -50,12 +53,12 @@ func TestMerge(t *testing.T) {
 
 func TestGetQuery(t *testing.T) {
 	db := new(DB)
-	db.qm = make(queryMap)
+	db.reg.clear()
 	err := db.ParseFiles(parseFile)
 	if err != nil {
 		t.Fatal("ParseFile err;", err)
 	}
-	q, err := db.qm.getQuery("two")
+	q, err := db.reg.getQuery("two")
 	if err != nil {
 		t.Fatal("qm.getQuery error;", err)
 	}
@@ -63,7 +66,7 @@ func TestGetQuery(t *testing.T) {
 	if q.sql != exp {
 		t.Fatal("\nExpected:\n", exp, "\nGot:\n", q.sql)
 	}
-	q, err = db.qm.getQuery("none")
+	q, err = db.reg.getQuery("none")
 	if err == nil || q != nil {
 		t.Fatal("Expected an error and empty sql;\n", "Got:", q.sql)
 	}
@@ -71,7 +74,6 @@ func TestGetQuery(t *testing.T) {
 
 func TestParseSqlErr(t *testing.T) {
 	db := new(DB)
-	db.qm = make(queryMap)
 	err := db.ParseSQL(strings.NewReader(""))
 	if err == nil {
 		t.Fatal("Expected a parse error")
@@ -84,6 +86,10 @@ func TestParseSqlErr(t *testing.T) {
 	if err == nil {
 		t.Fatal("Expected a parse error")
 	}
+	err = db.ParseSQL(strings.NewReader("-- name: t\n-- timeout: soon\nselect 1;"))
+	if pe, ok := err.(*ParseError); !ok || pe.Pos.Line != 1 {
+		t.Fatal("Expected a parse error on line 1, got", err)
+	}
 }
 
 var parseExpect = queryMap{
@@ -92,21 +98,28 @@ var parseExpect = queryMap{
 	"000000": &query{sql: "select 3;"},
 	"000001": &query{sql: "select 4"},
 	"five":   &query{sql: "select 5"},
-	"func":   &query{sql: "create or replace function tester() returns integer language 'sql' as $$ select 1; $$;"},
-	"000002": &query{sql: "create or replace function another() returns integer language 'sql' as $$ select 2; $$;"},
+	"func":   &query{sql: "create or replace function tester() returns integer language 'sql' as $$\n        select 1;\n    $$;"},
+	"000002": &query{sql: "create or replace function another() returns integer language 'sql' as $$\n        select 2;\n    $$;"},
 }
 
 // Tests ParseSql and ParseFile at once
 func TestParseFiles(t *testing.T) {
 	db := new(DB)
-	db.qm = make(queryMap)
+	db.reg.clear()
 	err := db.ParseFiles(parseFile)
 	if err != nil {
 		t.Fatal("ParseFile err;", err)
 	}
-	if msg := compareQm(parseExpect, db.qm); msg != nil {
+	if msg := compareQm(parseExpect, db.reg.queries()); msg != nil {
 		t.Fatal(msg...)
 	}
+	info, err := db.Describe("one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.File != parseFile || info.Line != 10 || info.EndLine != 13 {
+		t.Error("Expected position", parseFile, 10, 13, "Got:", info.File, info.Line, info.EndLine)
+	}
 	err = db.ParseFiles()
 	if err == nil {
 		t.Fatal("Expected error for empty file list")
@@ -121,13 +134,113 @@ func TestParseFiles(t *testing.T) {
 // Parsing and merging is already tested, here we'll settle for the map size only
 func TestParsePath(t *testing.T) {
 	db := new(DB)
-	db.qm = make(queryMap)
+	db.reg.clear()
 	err := db.ParsePath(queriesDir)
 	if err != nil {
 		t.Fatal("ParseFileGlob err;", err)
 	}
-	exp, got := 5, len(db.qm)
+	exp, got := 8, len(db.reg.queries())
 	if exp != got {
 		t.Fatal("Expected", exp, "queries in the map; Got", got)
 	}
 }
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/one.sql":        {Data: []byte("-- name: one\nselect 1;")},
+		"sql/sub/two.sql":    {Data: []byte("-- name: two\nselect 2;")},
+		"sql/sub/readme.txt": {Data: []byte("Not parsed")},
+		"three.query":        {Data: []byte("-- name: three\nselect 3;")},
+	}
+	tests := []struct {
+		patterns []string
+		exp      []string
+	}{
+		{nil, []string{"one", "two"}},
+		{[]string{"sql"}, []string{"one", "two"}},
+		{[]string{"sql/*.sql"}, []string{"one"}},
+		{[]string{"sql/sub", "*.query"}, []string{"three", "two"}},
+	}
+	for _, ft := range tests {
+		db := new(DB)
+		db.reg.clear()
+		if err := db.ParseFS(fsys, ft.patterns...); err != nil {
+			t.Fatal(ft.patterns, err)
+		}
+		if got := db.List(); !reflect.DeepEqual(ft.exp, got) {
+			t.Error(ft.patterns, "Expected:", ft.exp, "Got:", got)
+		}
+	}
+	db := new(DB)
+	db.reg.clear()
+	if err := db.ParseFS(fsys, "none"); err == nil {
+		t.Error("Expected error for no matching files")
+	}
+	if err := db.ParseFS(fsys, "["); err == nil {
+		t.Error("Expected error for bad pattern")
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	db := new(DB)
+	err := db.ParseSQL(strings.NewReader("-- name: one\nselect 1;\n-- name: one\nselect 2;"))
+	exp := `Duplicate query name "one": defined at 1:1 and 3:1`
+	if _, ok := err.(*DuplicateError); !ok || err.Error() != exp {
+		t.Fatal("Expected error", exp, "Got:", err)
+	}
+	if db.HasQueries() {
+		t.Fatal("Failed parse should not add queries")
+	}
+
+	if err = db.ParseFiles(parseFile); err != nil {
+		t.Fatal(err)
+	}
+	err = db.parseSQL(strings.NewReader("select 0;\n-- name: two\nselect 22;"), "other.sql")
+	exp = `Duplicate query name "two": defined at tests/parse.sql:15:1 and other.sql:2:1`
+	if _, ok := err.(*DuplicateError); !ok || err.Error() != exp {
+		t.Fatal("Expected error", exp, "Got:", err)
+	}
+	if q := db.reg.queries()["two"]; q.sql != "select 2;" {
+		t.Fatal("Query overwritten after failed parse:", q.sql)
+	}
+	if db.reg.qn != 3 {
+		t.Fatal("Expected auto number 3 after failed parse, got", db.reg.qn)
+	}
+
+	db.Duplicates = DuplicateOverride
+	if err = db.parseSQL(strings.NewReader("select 0;\n-- name: two\nselect 22;"), "other.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if q := db.reg.queries()["two"]; q.sql != "select 22;" || q.start.File != "other.sql" {
+		t.Fatal("Query not overwritten:", q.sql, q.start)
+	}
+	if db.reg.queries()["000003"] == nil {
+		t.Fatal("Unnamed query not parsed")
+	}
+}
+
+func TestParseOverridePrepared(t *testing.T) {
+	ctx := context.Background()
+	cdb, err := New(Default.ConnPoolConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cdb.Close()
+	cdb.Duplicates = DuplicateOverride
+	cdb.PrepareMode = PrepareLazy
+	if err = cdb.ParseSQL(strings.NewReader("-- name: one\nselect 1;")); err != nil {
+		t.Fatal(err)
+	}
+	old := cdb.reg.queries()["one"]
+	var n int
+	if err = cdb.Get(ctx, &n, "one"); err != nil || n != 1 || !cdb.reg.prepared(old) {
+		t.Fatal("Expected prepared query with result 1, got:", n, err)
+	}
+	if err = cdb.ParseSQL(strings.NewReader("-- name: one\nselect 2;")); err != nil {
+		t.Fatal(err)
+	}
+	// The new query is prepared again under the same name
+	if err = cdb.Get(ctx, &n, "one"); err != nil || n != 2 {
+		t.Fatal("Expected result 2, got:", n, err)
+	}
+}
@@ -0,0 +1,106 @@
+package dotpgx
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx"
+)
+
+// PrepareMode determines when queries get prepared.
+type PrepareMode int
+
+const (
+	// PrepareNone only prepares queries on a call to Prepare or PrepareAll.
+	PrepareNone PrepareMode = iota
+	// PrepareLazy prepares a query on its first use.
+	// Inside a transaction, the query is prepared on the connection of the transaction only,
+	// see Tx.PrepareContext.
+	PrepareLazy
+	// PrepareEager prepares queries as soon as they are parsed.
+	// Queries that fail to prepare are prepared again on their first use, like PrepareLazy.
+	PrepareEager
+)
+
+// sql returns the prepared statement name or the SQL to execute the query identified by name.
+// Unless db.PrepareMode is PrepareNone, the query is prepared if it is not yet.
+func (db *DB) sql(ctx context.Context, name string) (string, error) {
+	q, sql, err := db.reg.sql(name)
+	if err != nil || db.PrepareMode == PrepareNone || db.reg.prepared(q) {
+		return sql, err
+	}
+	ps, err := db.PrepareContext(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return ps.Name, nil
+}
+
+// prepareError wraps err of a query that failed to prepare,
+// with a message that mentions the source position and SQL of the query.
+func prepareError(name string, q *query, err error) error {
+	m := []string{
+		"Error in preparing statement:",
+		q.start.String() + ":",
+		name,
+		"; With query:",
+		q.sql,
+	}
+	return &msgError{msg: strings.Join(m, " "), err: err}
+}
+
+// prepareNames prepares the queries identified by names.
+// It attempts all queries, the MultiError holds each query that failed.
+func (db *DB) prepareNames(ctx context.Context, names []string) error {
+	var errs MultiError
+	qm := db.reg.queries()
+	for _, name := range names {
+		if _, err := db.PrepareContext(ctx, name); err != nil && qm[name] != nil {
+			errs = append(errs, prepareError(name, qm[name], err))
+		}
+	}
+	return errs.err()
+}
+
+// txStatement returns the name of the statement of a query prepared in a transaction.
+// It differs from the name used on the pool, which does not know about statements
+// prepared in a transaction. The hash of the SQL keeps a changed query from reusing the name
+// of a statement that is still prepared on the connection.
+func txStatement(name, sql string) string {
+	h := fnv.New32a()
+	h.Write([]byte(sql))
+	return "dotpgx_tx_" + name + "_" + strconv.FormatUint(uint64(h.Sum32()), 36)
+}
+
+// sql returns the prepared statement name or the SQL to execute the query
+// identified by name on the connection of the transaction.
+// Statements prepared on the pool after the transaction began are not used,
+// as the connection of the transaction may lack them.
+// Unless the PrepareMode of the DB is PrepareNone,
+// the query is prepared on the connection if it is not yet.
+func (tx *Tx) sql(ctx context.Context, name string) (string, error) {
+	if tx.done {
+		return "", pgx.ErrTxClosed
+	}
+	q, sql, err := tx.reg.sqlAt(name, tx.gen)
+	if err != nil {
+		return "", err
+	}
+	if ps := tx.prepared[name]; ps != nil {
+		if ps.SQL == q.sql {
+			return ps.Name, nil
+		}
+		// The query changed since it was prepared
+		return q.sql, nil
+	}
+	if sql != q.sql || tx.mode == PrepareNone {
+		return sql, nil
+	}
+	ps, err := tx.PrepareContext(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return ps.Name, nil
+}
@@ -0,0 +1,170 @@
+package dotpgx
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx"
+)
+
+func TestTxSQL(t *testing.T) {
+	var r registry
+	cdb := &DB{}
+	if err := cdb.ParseSQL(strings.NewReader("-- name: one\nselect 1;\n-- name: two\nselect 2;")); err != nil {
+		t.Fatal(err)
+	}
+	r.qm = cdb.reg.queries()
+	ctx := context.Background()
+
+	r.setPrepared(r.qm["one"], &pgx.PreparedStatement{Name: "one", SQL: "select 1;"})
+	tx := &Tx{
+		reg:      &r,
+		gen:      r.generation(),
+		prepared: map[string]*pgx.PreparedStatement{"two": {Name: "two", SQL: "select 2;"}},
+	}
+	// Prepared on the pool after the transaction began
+	r.setPrepared(r.qm["two"], &pgx.PreparedStatement{Name: "two", SQL: "select 2;"})
+	late := &Tx{reg: &r, gen: 0}
+
+	tests := []struct {
+		tx   *Tx
+		name string
+		exp  string
+	}{
+		{tx, "one", "one"},
+		{tx, "two", "two"},
+		{late, "one", "select 1;"},
+		{late, "two", "select 2;"},
+	}
+	for _, tt := range tests {
+		got, err := tt.tx.sql(ctx, tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.exp {
+			t.Error(tt.name, "Expected:", tt.exp, "Got:", got)
+		}
+	}
+	// A query changed since it was prepared on the transaction
+	tx.prepared["one"] = &pgx.PreparedStatement{Name: "one", SQL: "select 11;"}
+	if got, _ := tx.sql(ctx, "one"); got != "select 1;" {
+		t.Error("Expected: select 1; Got:", got)
+	}
+	if _, err := tx.sql(ctx, "three"); err == nil {
+		t.Error("Expected error for unknown query")
+	}
+}
+
+func TestPrepareMode(t *testing.T) {
+	ctx := context.Background()
+	cdb, err := New(Default.ConnPoolConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cdb.Close()
+
+	cdb.PrepareMode = PrepareEager
+	if err = cdb.ParsePath(queriesDir); err != nil {
+		t.Fatal(err)
+	}
+	for name, q := range cdb.reg.queries() {
+		if !cdb.reg.prepared(q) {
+			t.Error("Query not prepared on parse:", name)
+		}
+	}
+	// New connections get the prepared statements
+	conns := make([]*pgx.Conn, 3)
+	for i := range conns {
+		if conns[i], err = cdb.Pool.Acquire(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range conns {
+		if _, err = c.Exec("find-peers-by-email", "foo@bar.com"); err != nil {
+			t.Error(err)
+		}
+		cdb.Pool.Release(c)
+	}
+	if err = cdb.ClearMap(); err != nil {
+		t.Fatal(err)
+	}
+
+	cdb.PrepareMode = PrepareLazy
+	if err = cdb.ParsePath(queriesDir); err != nil {
+		t.Fatal(err)
+	}
+	name := "find-peers-by-email"
+	q := cdb.reg.queries()[name]
+	if cdb.reg.prepared(q) {
+		t.Fatal("Query prepared before use")
+	}
+	tx, err := cdb.BeginContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, name, "foo@bar.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if tx.prepared[name] == nil || cdb.reg.prepared(q) {
+		t.Fatal("Query should be prepared on the transaction only")
+	}
+	rows, err = cdb.QueryContext(ctx, name, "foo@bar.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if !cdb.reg.prepared(q) {
+		t.Fatal("Query not prepared on first use")
+	}
+}
+
+func TestTxStatement(t *testing.T) {
+	a := txStatement("one", "select 1;")
+	if !strings.HasPrefix(a, "dotpgx_tx_one_") || a == "one" {
+		t.Error("Unexpected name:", a)
+	}
+	if b := txStatement("one", "select 11;"); a == b || a != txStatement("one", "select 1;") {
+		t.Error("Names not unique per SQL:", a, b)
+	}
+}
+
+func TestTxPrepareReload(t *testing.T) {
+	ctx := context.Background()
+	conf := Default.ConnPoolConfig()
+	conf.MaxConnections = 1
+	cdb, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cdb.Close()
+	cdb.Duplicates = DuplicateOverride
+	cdb.PrepareMode = PrepareLazy
+	if err = cdb.ParseSQL(strings.NewReader("-- name: one\nselect 1;")); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := cdb.BeginContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err = tx.Get(ctx, &n, "one"); err != nil || n != 1 {
+		t.Fatal("Expected 1, got:", n, err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// The single connection still holds the statement of the transaction
+	if err = cdb.ParseSQL(strings.NewReader("-- name: one\nselect 2;")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cdb.PrepareContext(ctx, "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err = cdb.Get(ctx, &n, "one"); err != nil || n != 2 {
+		t.Fatal("Expected 2, got:", n, err)
+	}
+}
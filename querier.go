@@ -0,0 +1,41 @@
+package dotpgx
+
+import (
+	"context"
+
+	"github.com/jackc/pgx"
+)
+
+// Querier runs named queries. It is implemented by DB and Tx,
+// so code can be written to run on the pool or inside an open transaction.
+// Begin starts a transaction on a DB, or a nested transaction on a Tx.
+type Querier interface {
+	Prepare(name string) (*pgx.PreparedStatement, error)
+	PrepareContext(ctx context.Context, name string) (*pgx.PreparedStatement, error)
+
+	Query(name string, args ...interface{}) (*pgx.Rows, error)
+	QueryContext(ctx context.Context, name string, args ...interface{}) (*pgx.Rows, error)
+	QueryRow(name string, args ...interface{}) (*pgx.Row, error)
+	QueryRowContext(ctx context.Context, name string, args ...interface{}) (*pgx.Row, error)
+	Exec(name string, args ...interface{}) (pgx.CommandTag, error)
+	ExecContext(ctx context.Context, name string, args ...interface{}) (pgx.CommandTag, error)
+
+	QueryNamed(name string, arg interface{}) (*pgx.Rows, error)
+	QueryNamedContext(ctx context.Context, name string, arg interface{}) (*pgx.Rows, error)
+	QueryRowNamed(name string, arg interface{}) (*pgx.Row, error)
+	QueryRowNamedContext(ctx context.Context, name string, arg interface{}) (*pgx.Row, error)
+	ExecNamed(name string, arg interface{}) (pgx.CommandTag, error)
+	ExecNamedContext(ctx context.Context, name string, arg interface{}) (pgx.CommandTag, error)
+
+	Get(ctx context.Context, dest interface{}, name string, args ...interface{}) error
+	Select(ctx context.Context, dest interface{}, name string, args ...interface{}) error
+
+	Begin() (*Tx, error)
+	BeginContext(ctx context.Context) (*Tx, error)
+	BeginBatch() *Batch
+}
+
+var (
+	_ Querier = (*DB)(nil)
+	_ Querier = (*Tx)(nil)
+)
@@ -0,0 +1,32 @@
+package dotpgx
+
+import (
+	"context"
+	"testing"
+)
+
+// findPeers is written once and runs on DB as well as Tx.
+func findPeers(q Querier, email string) ([]peer, error) {
+	rows, err := q.QueryContext(context.Background(), "find-peers-by-email", email)
+	if err != nil {
+		return nil, err
+	}
+	return rowScan(rows)
+}
+
+func TestQuerier(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, q := range []Querier{db, tx} {
+		got, err := findPeers(q, "foo@bar.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := comparePeers(peers[:2], got); msg != nil {
+			t.Fatal(msg...)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package dotpgx
+
+import (
+	"sync"
+
+	"github.com/jackc/pgx"
+)
+
+// registry holds the parsed queries of a DB. It is safe for concurrent use.
+// The query map is copied on write: a stored map is never modified,
+// so a snapshot can be read without holding the lock.
+// The prepared statement of a query is the only field that changes
+// after parsing, it is guarded by the same lock.
+// Prepared statements stored here are prepared on all connections of the pool.
+type registry struct {
+	// Held for reading while preparing a statement on the pool,
+	// for writing while queries are replaced and their statements deallocated.
+	// This keeps a query from being prepared under a name
+	// that still holds the statement of the query it replaced.
+	stmts sync.RWMutex
+	wmu   sync.Mutex   // Serializes updates
+	mu    sync.RWMutex // Guards the fields below and the prepared statements
+	qm    queryMap
+	qn    int // Incremented value for unamed queries
+	gen   int // Incremented for every prepared statement
+}
+
+// queries returns a snapshot of the query map.
+func (r *registry) queries() queryMap {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.qm
+}
+
+func (r *registry) getQuery(name string) (*query, error) {
+	return r.queries().getQuery(name)
+}
+
+// sql returns the query identified by name and the SQL or prepared statement name to execute.
+func (r *registry) sql(name string) (*query, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	q, err := r.qm.getQuery(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return q, q.getSQL(), nil
+}
+
+// generation returns the current prepare generation.
+func (r *registry) generation() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.gen
+}
+
+// sqlAt is like sql, but it only returns the name of a statement
+// that was prepared at or before generation gen.
+// Connections acquired before a statement got prepared on the pool may lack it.
+func (r *registry) sqlAt(name string, gen int) (*query, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	q, err := r.qm.getQuery(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if q.isPrepared() && q.gen <= gen {
+		return q, q.ps.Name, nil
+	}
+	return q, q.sql, nil
+}
+
+// prepared reports if q is prepared.
+func (r *registry) prepared(q *query) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return q.isPrepared()
+}
+
+// setPrepared stores the prepared statement of q.
+func (r *registry) setPrepared(q *query, ps *pgx.PreparedStatement) {
+	r.mu.Lock()
+	r.gen++
+	q.ps, q.gen = ps, r.gen
+	r.mu.Unlock()
+}
+
+// update replaces the query map and counter by the result of fn,
+// unless fn returns an error. Fn must not modify qm.
+// Updates are serialized, readers are only blocked while the result is stored.
+func (r *registry) update(fn func(qm queryMap, qn int) (queryMap, int, error)) error {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	r.mu.RLock()
+	qm, qn := r.qm, r.qn
+	r.mu.RUnlock()
+	qm, qn, err := fn(qm, qn)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.qm, r.qn = qm, qn
+	r.mu.Unlock()
+	return nil
+}
+
+// drop removes the query identified by name and returns it, nil if it does not exist.
+func (r *registry) drop(name string) (q *query) {
+	r.update(func(qm queryMap, qn int) (queryMap, int, error) {
+		q = qm[name]
+		nqm := make(queryMap, len(qm))
+		for k, v := range qm {
+			if k != name {
+				nqm[k] = v
+			}
+		}
+		return nqm, qn, nil
+	})
+	return q
+}
+
+// clear removes all queries and resets the counter. It returns the removed queries.
+func (r *registry) clear() queryMap {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	qm := r.qm
+	r.qm, r.qn = nil, 0
+	return qm
+}
+
+// wrap err of the query identified by name in a QueryError,
+// if it is reported by PostgreSQL.
+func (r *registry) wrap(name string, err error) error {
+	if SQLState(err) == "" {
+		return err
+	}
+	q, qerr := r.getQuery(name)
+	if qerr != nil {
+		return err
+	}
+	return q.wrap(name, err)
+}
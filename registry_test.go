@@ -0,0 +1,82 @@
+package dotpgx
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx"
+)
+
+func TestRegistry(t *testing.T) {
+	var r registry
+	if _, _, err := r.sql("one"); err == nil {
+		t.Fatal("Expected error for unknown query")
+	}
+	q := &query{sql: "select 1;"}
+	err := r.update(func(qm queryMap, qn int) (queryMap, int, error) {
+		return merge(qm, queryMap{"one": q}), qn + 1, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := r.queries()
+	if _, sql, _ := r.sql("one"); sql != "select 1;" {
+		t.Fatal("Expected: select 1; Got:", sql)
+	}
+	r.setPrepared(q, &pgx.PreparedStatement{Name: "one"})
+	if _, sql, _ := r.sql("one"); sql != "one" || !r.prepared(q) {
+		t.Fatal("Expected prepared statement name, got:", sql)
+	}
+	// Failed updates don't change anything
+	err = r.update(func(qm queryMap, qn int) (queryMap, int, error) {
+		return nil, 0, fmt.Errorf("Failed")
+	})
+	if err == nil || r.queries()["one"] != q || r.qn != 1 {
+		t.Fatal("Failed update changed the registry")
+	}
+	if r.drop("one") != q || r.drop("one") != nil {
+		t.Fatal("Wrong drop result")
+	}
+	// Stored maps are not modified
+	if snapshot["one"] != q {
+		t.Fatal("Snapshot modified by drop")
+	}
+	if qm := r.clear(); len(qm) != 0 || r.qn != 0 {
+		t.Fatal("Wrong clear result", qm, r.qn)
+	}
+}
+
+// TestRegistryConcurrent is meant to run with the race detector.
+func TestRegistryConcurrent(t *testing.T) {
+	cdb := new(DB)
+	cdb.Duplicates = DuplicateOverride
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprintf("q%d", j%5)
+				sql := fmt.Sprintf("-- name: %s\nselect :a;\nselect %d;", name, i)
+				if err := cdb.ParseSQL(strings.NewReader(sql)); err != nil {
+					t.Error(err)
+					return
+				}
+				cdb.HasQueries()
+				cdb.List()
+				cdb.Describe(name)
+				cdb.reg.queries().bind(name, map[string]interface{}{"a": 1})
+				cdb.reg.sql(name)
+				if j%10 == 0 {
+					cdb.DropQuery(name)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if !cdb.HasQueries() {
+		t.Fatal("No queries after concurrent parse")
+	}
+}
@@ -0,0 +1,102 @@
+package dotpgx
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// Defaults for the retry behaviour of RunInTx.
+const (
+	DefaultTxRetries = 3
+	DefaultTxBackoff = 10 * time.Millisecond
+	MaxTxBackoff     = 5 * time.Second
+)
+
+// TxOptions for RunInTx.
+type TxOptions struct {
+	// Isolation level, access mode and deferrable mode of the transaction.
+	pgx.TxOptions
+	// MaxRetries is the maximum number of retries after
+	// a serialization failure or deadlock.
+	// Zero means DefaultTxRetries, a negative value disables retries.
+	MaxRetries int
+	// Backoff is the wait before the first retry,
+	// it is doubled on every next retry, up to MaxTxBackoff.
+	// Zero means DefaultTxBackoff.
+	Backoff time.Duration
+}
+
+// retryable reports if err is a serialization failure or a deadlock,
+// after which the transaction can be retried.
+func retryable(err error) bool {
+	code := SQLState(err)
+	return code == CodeSerializationFailure || code == CodeDeadlockDetected
+}
+
+// txBackoff returns the wait before retry number i, counting from 0.
+// A Backoff above MaxTxBackoff is used as-is.
+func txBackoff(backoff time.Duration, i int) time.Duration {
+	d := backoff
+	for ; i > 0 && d < MaxTxBackoff; i-- {
+		d *= 2
+	}
+	if d > MaxTxBackoff && backoff <= MaxTxBackoff {
+		return MaxTxBackoff
+	}
+	return d
+}
+
+// RunInTx runs fn inside a transaction.
+// The transaction is committed if fn returns nil,
+// and rolled back if fn returns an error or panics.
+// A panic is re-raised after the rollback.
+// When fn or the commit fails with a serialization failure (40001)
+// or deadlock (40P01), fn is run again in a new transaction,
+// after a backoff and up to the number of retries set in opts.
+// Nil opts uses the server defaults for the transaction and the default retries.
+func (db *DB) RunInTx(ctx context.Context, opts *TxOptions, fn func(tx *Tx) error) error {
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	retries, backoff := opts.MaxRetries, opts.Backoff
+	if retries == 0 {
+		retries = DefaultTxRetries
+	}
+	if backoff == 0 {
+		backoff = DefaultTxBackoff
+	}
+	for i := 0; ; i++ {
+		err := db.runInTx(ctx, &opts.TxOptions, fn)
+		if err == nil || i >= retries || !retryable(err) {
+			return err
+		}
+		t := time.NewTimer(txBackoff(backoff, i))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// runInTx makes a single attempt for RunInTx.
+func (db *DB) runInTx(ctx context.Context, opts *pgx.TxOptions, fn func(tx *Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.CommitContext(ctx)
+}
@@ -0,0 +1,142 @@
+package dotpgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := map[error]bool{
+		pgx.PgError{Code: "40001"}:                            true,
+		&pgx.PgError{Code: "40P01"}:                           true,
+		fmt.Errorf("wrapped: %w", pgx.PgError{Code: "40001"}): true,
+		pgx.PgError{Code: "23505"}:                            false,
+		errors.New("40001"):                                   false,
+	}
+	for err, exp := range tests {
+		if got := retryable(err); got != exp {
+			t.Error(err, "Expected:", exp, "Got:", got)
+		}
+	}
+}
+
+func TestTxBackoff(t *testing.T) {
+	tests := []struct {
+		backoff time.Duration
+		i       int
+		exp     time.Duration
+	}{
+		{10 * time.Millisecond, 0, 10 * time.Millisecond},
+		{10 * time.Millisecond, 3, 80 * time.Millisecond},
+		{10 * time.Millisecond, 9, MaxTxBackoff},
+		{10 * time.Millisecond, 100, MaxTxBackoff},
+		{time.Nanosecond, 1 << 20, MaxTxBackoff},
+		{time.Minute, 5, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := txBackoff(tt.backoff, tt.i); got != tt.exp {
+			t.Error(tt.backoff, tt.i, "Expected:", tt.exp, "Got:", got)
+		}
+	}
+}
+
+func countPeers(t *testing.T, email string) int {
+	rows, err := db.Query("find-peers-by-email", email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := rowScan(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(got)
+}
+
+func TestRunInTx(t *testing.T) {
+	ctx := context.Background()
+	const email = "runintx@example.com"
+	defer db.Pool.Exec("delete from peers where email = $1", email)
+
+	// Commit
+	err := db.RunInTx(ctx, nil, func(tx *Tx) error {
+		_, err := tx.Exec("create-peer", "Committed", email)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countPeers(t, email); n != 1 {
+		t.Fatal("Expected 1 peer, got:", n)
+	}
+
+	// Rollback on error
+	errFn := errors.New("Rollback please")
+	err = db.RunInTx(ctx, nil, func(tx *Tx) error {
+		if _, err := tx.Exec("create-peer", "Rolled back", email); err != nil {
+			return err
+		}
+		return errFn
+	})
+	if err != errFn {
+		t.Fatal("Expected:", errFn, "Got:", err)
+	}
+	if n := countPeers(t, email); n != 1 {
+		t.Fatal("Expected 1 peer, got:", n)
+	}
+
+	// Rollback on panic
+	func() {
+		defer func() {
+			if p := recover(); p != "oops" {
+				t.Fatal("Expected panic oops, got:", p)
+			}
+		}()
+		db.RunInTx(ctx, nil, func(tx *Tx) error {
+			tx.Exec("create-peer", "Panicked", email)
+			panic("oops")
+		})
+	}()
+	if n := countPeers(t, email); n != 1 {
+		t.Fatal("Expected 1 peer, got:", n)
+	}
+
+	// Retry on serialization failure
+	var calls int
+	start := time.Now()
+	err = db.RunInTx(ctx, &TxOptions{MaxRetries: 2, Backoff: time.Millisecond}, func(tx *Tx) error {
+		calls++
+		return pgx.PgError{Code: "40001"}
+	})
+	if !retryable(err) || calls != 3 {
+		t.Fatal("Expected 3 calls and serialization failure, got:", calls, err)
+	}
+	if d := time.Since(start); d < 3*time.Millisecond {
+		t.Error("Backoff too short:", d)
+	}
+	calls = 0
+	err = db.RunInTx(ctx, &TxOptions{MaxRetries: -1}, func(tx *Tx) error {
+		calls++
+		return pgx.PgError{Code: "40P01"}
+	})
+	if err == nil || calls != 1 {
+		t.Fatal("Expected a single call, got:", calls, err)
+	}
+
+	// Read only
+	opts := &TxOptions{TxOptions: pgx.TxOptions{
+		IsoLevel:   pgx.Serializable,
+		AccessMode: pgx.ReadOnly,
+	}}
+	err = db.RunInTx(ctx, opts, func(tx *Tx) error {
+		_, err := tx.Exec("create-peer", "Read only", email)
+		return err
+	})
+	if err == nil {
+		t.Fatal("Expected error from insert in read only transaction")
+	}
+}
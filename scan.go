@@ -0,0 +1,203 @@
+package dotpgx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	scannerType       = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	textDecoderType   = reflect.TypeOf((*pgtype.TextDecoder)(nil)).Elem()
+	binaryDecoderType = reflect.TypeOf((*pgtype.BinaryDecoder)(nil)).Elem()
+)
+
+// isScalar reports if values of type t are scanned from a single column,
+// instead of being mapped by field.
+// This is the case for non-struct types, time.Time and
+// types implementing sql.Scanner or a pgtype decoder, like the pgtype values.
+func isScalar(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == timeType {
+		return true
+	}
+	pt := reflect.PtrTo(t)
+	return pt.Implements(scannerType) || pt.Implements(textDecoderType) || pt.Implements(binaryDecoderType)
+}
+
+// fieldAddr returns the address of the field of struct v at index.
+// Nil pointers to embedded structs are allocated,
+// which is not possible if the embedded struct type is unexported.
+func fieldAddr(v reflect.Value, index []int) (interface{}, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return nil, errors.New(strings.Join([]string{
+						"Cannot allocate nil pointer to unexported embedded struct", v.Type().String(),
+					}, " "))
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v.Addr().Interface(), nil
+}
+
+// destinations returns the scan destinations for the columns in fds,
+// pointing into v, which should be an addressable value.
+// An error listing the columns is returned if any column does not map to a field.
+func destinations(v reflect.Value, fds []pgx.FieldDescription) ([]interface{}, error) {
+	if isScalar(v.Type()) {
+		if len(fds) != 1 {
+			return nil, errors.New(strings.Join([]string{
+				"Cannot scan multiple columns into", v.Type().String(),
+			}, " "))
+		}
+		return []interface{}{v.Addr().Interface()}, nil
+	}
+	fi := fieldIndex(v.Type())
+	dest := make([]interface{}, len(fds))
+	var (
+		unmapped []string
+		err      error
+	)
+	for i, fd := range fds {
+		index, ok := fi[fd.Name]
+		if !ok {
+			unmapped = append(unmapped, fd.Name)
+			continue
+		}
+		if dest[i], err = fieldAddr(v, index); err != nil {
+			return nil, err
+		}
+	}
+	if len(unmapped) > 0 {
+		return nil, errors.New(strings.Join([]string{
+			"Unmapped columns for " + v.Type().String(), strings.Join(unmapped, ", "),
+		}, ": "))
+	}
+	return dest, nil
+}
+
+// scanValue scans the current row into a new value of type t.
+func scanValue(rows *pgx.Rows, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	dest, err := destinations(v, rows.FieldDescriptions())
+	if err != nil {
+		return v, err
+	}
+	return v, rows.Scan(dest...)
+}
+
+// scanOne scans the first row into dest, which should be a pointer.
+// Remaining rows are discarded. Returns pgx.ErrNoRows if there are no rows.
+func scanOne(rows *pgx.Rows, dest interface{}) error {
+	defer rows.Close()
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Ptr || d.IsNil() {
+		return errors.New("Scan destination should be a non-nil pointer")
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	v, err := scanValue(rows, d.Elem().Type())
+	if err != nil {
+		return err
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	d.Elem().Set(v)
+	return nil
+}
+
+// scanAll scans all rows into dest, which should be a pointer to a slice.
+// The elements can be structs, pointers to structs or scalar values.
+// Dest is only set if all rows are scanned without error.
+func scanAll(rows *pgx.Rows, dest interface{}) error {
+	defer rows.Close()
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Ptr || d.IsNil() || d.Elem().Kind() != reflect.Slice {
+		return errors.New("Scan destination should be a non-nil pointer to a slice")
+	}
+	st := d.Elem().Type()
+	et := st.Elem()
+	isPtr := et.Kind() == reflect.Ptr
+	if isPtr {
+		et = et.Elem()
+	}
+	s := reflect.MakeSlice(st, 0, 0)
+	for rows.Next() {
+		v, err := scanValue(rows, et)
+		if err != nil {
+			return err
+		}
+		if isPtr {
+			v = v.Addr()
+		}
+		s = reflect.Append(s, v)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	d.Elem().Set(s)
+	return nil
+}
+
+// Get runs the sql identified by name and scans the first row into dest.
+// Dest should be a pointer to a struct or a scalar value.
+// Columns are mapped to struct fields by their "db" tag or snake_cased field name,
+// including fields of embedded structs.
+// Use pointer or pgtype fields for columns that can be NULL.
+// Returns pgx.ErrNoRows if the query returns no rows.
+func (db *DB) Get(ctx context.Context, dest interface{}, name string, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, name, args...)
+	if err != nil {
+		return err
+	}
+	return scanOne(rows, dest)
+}
+
+// Select runs the sql identified by name and scans all rows into dest.
+// Dest should be a pointer to a slice of structs, pointers to structs or scalar values.
+// Columns are mapped like in Get.
+func (db *DB) Select(ctx context.Context, dest interface{}, name string, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, name, args...)
+	if err != nil {
+		return err
+	}
+	return scanAll(rows, dest)
+}
+
+// Get runs the sql identified by name and scans the first row into dest.
+// See DB.Get for details.
+func (tx *Tx) Get(ctx context.Context, dest interface{}, name string, args ...interface{}) error {
+	rows, err := tx.QueryContext(ctx, name, args...)
+	if err != nil {
+		return err
+	}
+	return scanOne(rows, dest)
+}
+
+// Select runs the sql identified by name and scans all rows into dest.
+// See DB.Select for details.
+func (tx *Tx) Select(ctx context.Context, dest interface{}, name string, args ...interface{}) error {
+	rows, err := tx.QueryContext(ctx, name, args...)
+	if err != nil {
+		return err
+	}
+	return scanAll(rows, dest)
+}
@@ -0,0 +1,125 @@
+package dotpgx
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+)
+
+func TestIsScalar(t *testing.T) {
+	tests := map[interface{}]bool{
+		0:                 true,
+		"":                true,
+		time.Time{}:       true,
+		pgtype.Text{}:     true,
+		pgtype.Numeric{}:  true,
+		withBase{}:        false,
+		struct{ A int }{}: false,
+	}
+	for v, exp := range tests {
+		if got := isScalar(reflect.TypeOf(v)); got != exp {
+			t.Errorf("isScalar(%T) Expected: %v Got: %v", v, exp, got)
+		}
+	}
+}
+
+type ScanBase struct {
+	ID int
+}
+
+type scanWithBase struct {
+	*ScanBase
+	Name string `db:"full_name"`
+}
+
+func TestDestinations(t *testing.T) {
+	fds := []pgx.FieldDescription{{Name: "full_name"}, {Name: "id"}}
+	var sb scanWithBase
+	dest, err := destinations(reflect.ValueOf(&sb).Elem(), fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sb.ScanBase == nil {
+		t.Fatal("Embedded struct not allocated")
+	}
+	if dest[0] != &sb.Name || dest[1] != &sb.ScanBase.ID {
+		t.Fatal("Wrong destinations:", dest)
+	}
+	// Unexported embedded struct pointer can't be allocated
+	var wb withBase
+	if _, err = destinations(reflect.ValueOf(&wb).Elem(), fds); err == nil {
+		t.Fatal("Expected error for unexported embedded struct")
+	}
+
+	fds = append(fds, pgx.FieldDescription{Name: "foo"}, pgx.FieldDescription{Name: "bar"})
+	_, err = destinations(reflect.ValueOf(&sb).Elem(), fds)
+	if err == nil || !strings.HasSuffix(err.Error(), ": foo, bar") {
+		t.Fatal("Expected unmapped columns error, got:", err)
+	}
+
+	var n int
+	dest, err = destinations(reflect.ValueOf(&n).Elem(), fds[:1])
+	if err != nil || dest[0] != &n {
+		t.Fatal("Wrong scalar destination:", dest, err)
+	}
+	if _, err = destinations(reflect.ValueOf(&n).Elem(), fds); err == nil {
+		t.Fatal("Expected error for multiple columns into scalar")
+	}
+}
+
+type scanPeer struct {
+	Name  *string
+	Email pgtype.Varchar
+}
+
+func TestGetSelect(t *testing.T) {
+	ctx := context.Background()
+	var p scanPeer
+	if err := db.Get(ctx, &p, "find-one-peer-by-email", "bar@foo.com"); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name == nil || *p.Name != "Lonely Ranger" || p.Email.String != "bar@foo.com" {
+		t.Fatal("Wrong peer:", p)
+	}
+	if err := db.Get(ctx, &p, "find-one-peer-by-email", "nobody@foo.com"); err != pgx.ErrNoRows {
+		t.Fatal("Expected ErrNoRows, got:", err)
+	}
+	var wb withBase
+	if err := db.Get(ctx, &wb, "find-one-peer-by-email", "bar@foo.com"); err == nil {
+		t.Fatal("Expected unmapped column error")
+	}
+
+	var ps []*scanPeer
+	if err := db.Select(ctx, &ps, "find-peers-by-email", "foo@bar.com"); err != nil {
+		t.Fatal(err)
+	}
+	var got []peer
+	for _, p := range ps {
+		got = append(got, peer{*p.Name, p.Email.String})
+	}
+	if msg := comparePeers(peers[:2], got); msg != nil {
+		t.Fatal(msg...)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	var names []string
+	if err = tx.Select(ctx, &names, "find-peers-by-email", "foo@bar.com"); err == nil {
+		t.Fatal("Expected error for multiple columns into scalar")
+	}
+	var s scanPeer
+	if err = tx.Get(ctx, &s, "find-one-peer-by-email", "bar@foo.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Select(ctx, &ps, "find-peers-by-email", "nobody@foo.com"); err != nil || len(ps) != 0 {
+		t.Fatal("Expected empty result, got:", ps, err)
+	}
+}
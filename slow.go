@@ -0,0 +1,175 @@
+package dotpgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// DefaultExplainTimeout is the timeout of EXPLAIN,
+// if SlowQueryLog.ExplainTimeout is not set.
+const DefaultExplainTimeout = time.Second
+
+var (
+	errExplainBusy = errors.New("No free connection to explain on")
+	errExplainRows = errors.New("Cannot explain while the rows are read on the connection of the transaction")
+	errExplainTx   = errors.New("Cannot explain in a failed transaction")
+)
+
+// SlowQueryLog is a Hook that logs named queries which take longer than a threshold.
+// The threshold of a query is set by its "slow" annotation, like "-- slow: 200ms",
+// or Threshold if it has none. A threshold of 0 disables the log for a query.
+// Only Query, QueryRow and Exec are logged. QueryRow is timed until
+// the first result arrives, reading rows of Query is not included.
+type SlowQueryLog struct {
+	// Threshold applies to queries without a "slow" annotation.
+	Threshold time.Duration
+	// Logger receives the slow query records.
+	// It defaults to the Logger of the DB.
+	Logger Logger
+	// Redact returns the arguments as they are logged.
+	// It defaults to RedactArgs, which only logs the types.
+	Redact func(name string, args []interface{}) []interface{}
+	// Explain runs EXPLAIN (FORMAT JSON) for a slow query with the same arguments,
+	// and adds the plan to the record, before the query method returns.
+	// A query is explained on a free connection of the pool, or skipped if there is none.
+	// A statement in a transaction is explained on the connection of the transaction,
+	// inside a savepoint. This is only possible for Exec, as the rows
+	// of Query and QueryRow are not read yet, and not in a failed transaction.
+	// The reason of a skipped EXPLAIN is logged as explain_error.
+	Explain bool
+	// ExplainTimeout bounds the time to explain a query, including the wait for a connection.
+	// It defaults to DefaultExplainTimeout.
+	ExplainTimeout time.Duration
+
+	db *DB
+}
+
+// LogSlowQueries adds a SlowQueryLog with threshold to the hooks of db and returns it.
+// Like all hooks, it must be added before db is used.
+func (db *DB) LogSlowQueries(threshold time.Duration) *SlowQueryLog {
+	s := &SlowQueryLog{
+		Threshold: threshold,
+		db:        db,
+	}
+	db.Hooks = append(db.Hooks, s)
+	return s
+}
+
+// RedactArgs replaces each argument by its type.
+func RedactArgs(name string, args []interface{}) []interface{} {
+	r := make([]interface{}, len(args))
+	for i, a := range args {
+		r[i] = fmt.Sprintf("%T", a)
+	}
+	return r
+}
+
+// threshold returns the threshold of q.
+func (s *SlowQueryLog) threshold(q *query) time.Duration {
+	if v, ok := q.ann["slow"]; ok {
+		// Annotations are validated when parsed
+		d, _ := time.ParseDuration(v)
+		return d
+	}
+	return s.Threshold
+}
+
+// BeforeQuery implements Hook.
+func (s *SlowQueryLog) BeforeQuery(ctx context.Context, ev QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery implements Hook, it logs the query if it was slow.
+func (s *SlowQueryLog) AfterQuery(ctx context.Context, ev QueryEvent, err error) {
+	switch ev.Op {
+	case OpQuery, OpQueryRow, OpExec:
+	default:
+		return
+	}
+	q, qerr := s.db.reg.getQuery(ev.Name)
+	if qerr != nil {
+		return
+	}
+	th := s.threshold(q)
+	if th <= 0 || ev.Duration < th {
+		return
+	}
+	redact := s.Redact
+	if redact == nil {
+		redact = RedactArgs
+	}
+	ctxLog := []interface{}{
+		"query", ev.Name,
+		"duration", ev.Duration,
+		"threshold", th,
+		"args", redact(ev.Name, ev.Args),
+		"source", q.start.String(),
+	}
+	if err != nil {
+		ctxLog = append(ctxLog, "error", err)
+	}
+	if s.Explain && s.db.Pool != nil {
+		if plan, err := s.explain(ev); err != nil {
+			ctxLog = append(ctxLog, "explain_error", err)
+		} else {
+			ctxLog = append(ctxLog, "plan", plan)
+		}
+	}
+	lg := s.Logger
+	if lg == nil {
+		lg = s.db.log()
+	}
+	lg.Warn("Slow query", ctxLog...)
+}
+
+// explain returns the JSON plan of the query of ev.
+// The context of the query is not used, it may be done after a timeout.
+func (s *SlowQueryLog) explain(ev QueryEvent) (string, error) {
+	timeout := s.ExplainTimeout
+	if timeout <= 0 {
+		timeout = DefaultExplainTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	sql := "EXPLAIN (FORMAT JSON) " + ev.SQL
+	var plan string
+	if ev.Tx != nil {
+		return plan, explainTx(ctx, ev, sql, &plan)
+	}
+	// Don't wait for a connection the caller may hold, like the one of its rows
+	if st := s.db.Pool.Stat(); st.AvailableConnections == 0 && st.CurrentConnections >= st.MaxConnections {
+		return "", errExplainBusy
+	}
+	c, err := s.db.Pool.AcquireEx(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer s.db.Pool.Release(c)
+	err = c.QueryRowEx(ctx, sql, nil, ev.Args...).Scan(&plan)
+	return plan, err
+}
+
+// explainTx runs the EXPLAIN sql on the connection of the transaction of ev.
+// The savepoint keeps a failed EXPLAIN from failing the transaction.
+func explainTx(ctx context.Context, ev QueryEvent, sql string, plan *string) error {
+	tx := ev.Tx.Ptx
+	if ev.Op != OpExec {
+		return errExplainRows
+	}
+	if tx.Status() != pgx.TxStatusInProgress {
+		return errExplainTx
+	}
+	if _, err := tx.ExecEx(ctx, "savepoint dotpgx_explain", nil); err != nil {
+		return err
+	}
+	err := tx.QueryRowEx(ctx, sql, nil, ev.Args...).Scan(plan)
+	if err != nil {
+		tx.ExecEx(context.Background(), "rollback to savepoint dotpgx_explain", nil)
+	}
+	tx.ExecEx(context.Background(), "release savepoint dotpgx_explain", nil)
+	return err
+}
@@ -0,0 +1,172 @@
+package dotpgx
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowQueryLog(t *testing.T) {
+	cdb := new(DB)
+	in := "-- name: fast\n-- slow: 1s\nselect 1;\n-- name: default\nselect 2;\n-- name: never\n-- slow: 0s\nselect 3;"
+	if err := cdb.ParseSQL(strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+	s := cdb.LogSlowQueries(100 * time.Millisecond)
+	if len(cdb.Hooks) != 1 || cdb.Hooks[0] != s {
+		t.Fatal("SlowQueryLog not added to hooks")
+	}
+	rec := new(recordLogger)
+	s.Logger = rec
+
+	ctx := context.Background()
+	args := []interface{}{"secret", 1}
+	tests := []struct {
+		op   string
+		name string
+		d    time.Duration
+		slow bool
+	}{
+		{OpExec, "fast", 500 * time.Millisecond, false},
+		{OpExec, "fast", 2 * time.Second, true},
+		{OpQuery, "default", 50 * time.Millisecond, false},
+		{OpQueryRow, "default", 200 * time.Millisecond, true},
+		{OpPrepare, "default", time.Second, false},
+		{OpExec, "never", time.Hour, false},
+		{OpExec, "unknown", time.Hour, false},
+	}
+	for _, tt := range tests {
+		rec.records = nil
+		s.AfterQuery(ctx, QueryEvent{Op: tt.op, Name: tt.name, Args: args, Duration: tt.d}, nil)
+		if got := len(rec.records) == 1; got != tt.slow {
+			t.Error(tt.op, tt.name, tt.d, "Expected slow:", tt.slow, "Got:", got)
+		}
+	}
+
+	rec.records = nil
+	s.AfterQuery(ctx, QueryEvent{Op: OpExec, Name: "default", Args: args, Duration: time.Second}, nil)
+	m := rec.records[0].ctx
+	if m["query"] != "default" || m["threshold"] != 100*time.Millisecond || m["source"] != "4:1" {
+		t.Error("Wrong record:", m)
+	}
+	if exp := []interface{}{"string", "int"}; !reflect.DeepEqual(m["args"], exp) {
+		t.Error("Args not redacted:", m["args"])
+	}
+
+	// Custom redaction
+	rec.records = nil
+	s.Redact = func(name string, args []interface{}) []interface{} { return args[1:] }
+	s.AfterQuery(ctx, QueryEvent{Op: OpExec, Name: "default", Args: args, Duration: time.Second}, nil)
+	if got := rec.records[0].ctx["args"]; !reflect.DeepEqual(got, args[1:]) {
+		t.Error("Custom redaction not used:", got)
+	}
+}
+
+func TestSlowQueryExplain(t *testing.T) {
+	cdb, err := New(Default.ConnPoolConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cdb.Close()
+	if err = cdb.ParseSQL(strings.NewReader("-- name: sleep\n-- slow: 10ms\nselect pg_sleep($1);")); err != nil {
+		t.Fatal(err)
+	}
+	s := cdb.LogSlowQueries(0)
+	s.Explain = true
+	rec := new(recordLogger)
+	s.Logger = rec
+
+	rows, err := cdb.Query("sleep", 0.05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if len(rec.records) != 1 {
+		t.Fatal("Expected 1 record, got:", len(rec.records))
+	}
+	m := rec.records[0].ctx
+	if plan, _ := m["plan"].(string); !strings.Contains(plan, `"Plan"`) {
+		t.Error("Missing plan:", m)
+	}
+
+	// Explained on the connection of the transaction,
+	// which can see the table it created
+	tx, err := cdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err = tx.Ptx.Exec("create table slow_explain (id int)"); err != nil {
+		t.Fatal(err)
+	}
+	if err = cdb.ParseSQL(strings.NewReader("-- name: insert-sleep\n-- slow: 10ms\ninsert into slow_explain select 1 from pg_sleep($1);")); err != nil {
+		t.Fatal(err)
+	}
+	rec.records = nil
+	if _, err = tx.Exec("insert-sleep", 0.05); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.records) != 1 {
+		t.Fatal("Expected 1 record, got:", len(rec.records))
+	}
+	m = rec.records[0].ctx
+	if plan, _ := m["plan"].(string); !strings.Contains(plan, `"Plan"`) {
+		t.Error("Missing plan in transaction:", m)
+	}
+	// Rows of the transaction are not read yet
+	rec.records = nil
+	rows, err = tx.Query("sleep", 0.05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if m = rec.records[0].ctx; m["explain_error"] != errExplainRows {
+		t.Error("Expected explain_error:", errExplainRows, "Got:", m)
+	}
+	if _, err = tx.Exec("insert-sleep", 0); err != nil {
+		t.Error("Transaction not usable after explain:", err)
+	}
+}
+
+func TestSlowQueryExplainBusy(t *testing.T) {
+	conf := Default.ConnPoolConfig()
+	conf.MaxConnections = 1
+	cdb, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cdb.Close()
+	if err = cdb.ParseSQL(strings.NewReader("-- name: sleep\n-- slow: 10ms\nselect pg_sleep($1);")); err != nil {
+		t.Fatal(err)
+	}
+	s := cdb.LogSlowQueries(0)
+	s.Explain = true
+	rec := new(recordLogger)
+	s.Logger = rec
+
+	// The rows hold the only connection
+	done := make(chan error)
+	go func() {
+		rows, err := cdb.Query("sleep", 0.05)
+		if err == nil {
+			rows.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Query blocked by explain")
+	}
+	if len(rec.records) != 1 {
+		t.Fatal("Expected 1 record, got:", len(rec.records))
+	}
+	if m := rec.records[0].ctx; m["explain_error"] != errExplainBusy {
+		t.Error("Expected explain_error:", errExplainBusy, "Got:", m)
+	}
+}
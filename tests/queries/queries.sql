@@ -6,3 +6,12 @@ SELECT name,email FROM peers WHERE email = $1;
 
 -- name: find-one-peer-by-email
 SELECT name,email FROM peers WHERE email = $1 LIMIT 1;
+
+-- name: sleep
+SELECT pg_sleep($1);
+
+-- name: create-peer-named
+INSERT INTO peers (name, email) VALUES(:name, :email);
+
+-- name: find-peers-by-email-named
+SELECT name,email FROM peers WHERE email = @email;
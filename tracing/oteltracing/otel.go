@@ -0,0 +1,73 @@
+// Package oteltracing adapts an OpenTelemetry tracer to tracing.Tracer.
+//
+//	tracing.New(db, oteltracing.New(otel.Tracer("dotpgx")))
+package oteltracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/usrpro/dotpgx/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer implements tracing.Tracer with an OpenTelemetry tracer.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a Tracer that starts client spans on tracer.
+func New(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start implements tracing.Tracer.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(convert(attrs)...),
+	)
+	return ctx, &otelSpan{span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) SetAttributes(attrs ...tracing.Attribute) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+func (s *otelSpan) SetError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *otelSpan) End() {
+	s.span.End()
+}
+
+// convert attributes to OpenTelemetry key values.
+// Values of unsupported types are formatted as strings.
+func convert(attrs []tracing.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, len(attrs))
+	for i, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs[i] = attribute.String(a.Key, v)
+		case int:
+			kvs[i] = attribute.Int(a.Key, v)
+		case int64:
+			kvs[i] = attribute.Int64(a.Key, v)
+		case bool:
+			kvs[i] = attribute.Bool(a.Key, v)
+		case []string:
+			kvs[i] = attribute.StringSlice(a.Key, v)
+		default:
+			kvs[i] = attribute.String(a.Key, fmt.Sprint(v))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,57 @@
+package oteltracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/usrpro/dotpgx/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	tr := New(tp.Tracer("test"))
+
+	ctx, parent := tr.Start(context.Background(), "parent", tracing.Attribute{Key: "s", Value: "one"})
+	_, child := tr.Start(ctx, "child", tracing.Attribute{Key: "i", Value: 2})
+	child.SetAttributes(
+		tracing.Attribute{Key: "i64", Value: int64(3)},
+		tracing.Attribute{Key: "q", Value: []string{"a", "b"}},
+		tracing.Attribute{Key: "f", Value: 1.5},
+	)
+	child.SetError(errors.New("Failed"))
+	child.End()
+	parent.End()
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatal("Expected 2 spans, got:", len(spans))
+	}
+	c, p := spans[0], spans[1]
+	if c.Parent().SpanID() != p.SpanContext().SpanID() {
+		t.Error("Wrong parent")
+	}
+	if c.Status().Code != codes.Error || len(c.Events()) != 1 {
+		t.Error("Error not recorded:", c.Status(), c.Events())
+	}
+	exp := map[attribute.Key]attribute.Value{
+		"i":   attribute.IntValue(2),
+		"i64": attribute.Int64Value(3),
+		"q":   attribute.StringSliceValue([]string{"a", "b"}),
+		"f":   attribute.StringValue("1.5"),
+	}
+	got := make(map[attribute.Key]attribute.Value)
+	for _, kv := range c.Attributes() {
+		got[kv.Key] = kv.Value
+	}
+	for k, v := range exp {
+		if got[k].Emit() != v.Emit() {
+			t.Error(k, "Expected:", v.Emit(), "Got:", got[k].Emit())
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Recorder is a Tracer that keeps the spans in memory.
+// It is meant for tests and is safe for concurrent use.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan is a span started by a Recorder.
+// Its fields must not be read before the span has ended.
+type RecordedSpan struct {
+	rec *Recorder
+
+	Name               string
+	Parent             *RecordedSpan // Nil for root spans
+	Attributes         map[string]interface{}
+	Err                error
+	StartTime, EndTime time.Time
+	Ended              bool
+}
+
+type recorderKey struct{}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return new(Recorder)
+}
+
+// Start implements Tracer.
+func (r *Recorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(recorderKey{}).(*RecordedSpan)
+	s := &RecordedSpan{
+		rec:        r,
+		Name:       name,
+		Parent:     parent,
+		Attributes: make(map[string]interface{}),
+		StartTime:  time.Now(),
+	}
+	s.SetAttributes(attrs...)
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+	return context.WithValue(ctx, recorderKey{}, s), s
+}
+
+// Spans returns the started spans, in start order.
+func (r *Recorder) Spans() []*RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*RecordedSpan(nil), r.spans...)
+}
+
+// Reset removes all spans.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.spans = nil
+	r.mu.Unlock()
+}
+
+// SetAttributes implements Span.
+func (s *RecordedSpan) SetAttributes(attrs ...Attribute) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	for _, a := range attrs {
+		s.Attributes[a.Key] = a.Value
+	}
+}
+
+// SetError implements Span.
+func (s *RecordedSpan) SetError(err error) {
+	s.rec.mu.Lock()
+	s.Err = err
+	s.rec.mu.Unlock()
+}
+
+// End implements Span.
+func (s *RecordedSpan) End() {
+	s.rec.mu.Lock()
+	s.EndTime, s.Ended = time.Now(), true
+	s.rec.mu.Unlock()
+}
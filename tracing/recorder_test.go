@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	rec := NewRecorder()
+	ctx, parent := rec.Start(context.Background(), "parent", Attribute{"a", 1})
+	_, child := rec.Start(ctx, "child")
+	child.SetAttributes(Attribute{"b", "two"})
+	errChild := errors.New("Failed")
+	child.SetError(errChild)
+	child.End()
+	parent.End()
+
+	spans := rec.Spans()
+	if len(spans) != 2 {
+		t.Fatal("Expected 2 spans, got:", len(spans))
+	}
+	p, c := spans[0], spans[1]
+	if p.Parent != nil || c.Parent != p {
+		t.Error("Wrong parents")
+	}
+	if p.Attributes["a"] != 1 || c.Attributes["b"] != "two" {
+		t.Error("Wrong attributes:", p.Attributes, c.Attributes)
+	}
+	if c.Err != errChild || !c.Ended || c.EndTime.Before(c.StartTime) {
+		t.Error("Wrong child span:", c)
+	}
+	rec.Reset()
+	if len(rec.Spans()) != 0 {
+		t.Error("Spans not removed by Reset")
+	}
+}
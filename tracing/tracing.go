@@ -0,0 +1,216 @@
+/*
+Package tracing creates a span for every dotpgx query, transaction and batch.
+
+Spans of named queries are named after the query, other spans after the operation.
+A transaction span starts with Begin and ends with Commit or Rollback.
+Statements executed in a transaction are children of its span,
+other spans are children of the span in the context of the caller.
+QueryRow spans end before the row is scanned, so errors deferred until Scan,
+like pgx.ErrNoRows, do not mark them as failed, see dotpgx.Hook.
+
+The Tracer interface follows the OpenTelemetry model.
+Recorder is an in-memory Tracer for tests, see the oteltracing package
+for an OpenTelemetry adapter.
+
+	rec := tracing.NewRecorder()
+	tracing.New(db, rec)
+*/
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/usrpro/dotpgx"
+)
+
+// Attribute keys set on spans.
+const (
+	AttrSystem       = "db.system"
+	AttrStatement    = "db.statement"
+	AttrOperation    = "db.operation"
+	AttrQuery        = "dotpgx.query"
+	AttrQueued       = "dotpgx.queued"
+	AttrFile         = "code.filepath"
+	AttrLine         = "code.lineno"
+	AttrRowsAffected = "db.rows_affected"
+	AttrSQLState     = "db.sqlstate"
+)
+
+// TxSpanName is the name of transaction spans.
+const TxSpanName = "transaction"
+
+// Attribute is a key value pair set on a span.
+// Values are strings, ints, int64s, bools or string slices.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	// Start a span as a child of the span in ctx, if any.
+	// The returned context holds the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// SetError marks the span as failed.
+	SetError(err error)
+	End()
+}
+
+// Hook is a dotpgx.Hook that creates the spans.
+// It is safe for concurrent use.
+// The span of a transaction that is never committed or rolled back is not ended.
+// Spans of nested transactions that are closed by the rollback of their parent end with it.
+type Hook struct {
+	db     *dotpgx.DB
+	tracer Tracer
+
+	mu  sync.Mutex
+	txs map[*dotpgx.Tx]txSpan // Open transactions
+}
+
+type txSpan struct {
+	ctx    context.Context
+	span   Span
+	parent *dotpgx.Tx // Parent of a nested transaction
+}
+
+type spanKey struct{}
+
+// New returns a Hook that traces the operations on db with tracer
+// and adds it to the hooks of db.
+// Like all hooks, it must be added before db is used.
+func New(db *dotpgx.DB, tracer Tracer) *Hook {
+	h := &Hook{
+		db:     db,
+		tracer: tracer,
+		txs:    make(map[*dotpgx.Tx]txSpan),
+	}
+	db.Hooks = append(db.Hooks, h)
+	return h
+}
+
+// parent returns the context of the transaction span of tx, or ctx if tx is not traced.
+func (h *Hook) parent(ctx context.Context, tx *dotpgx.Tx) context.Context {
+	if tx == nil {
+		return ctx
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ts, ok := h.txs[tx]; ok {
+		return ts.ctx
+	}
+	return ctx
+}
+
+// BeforeQuery implements dotpgx.Hook, it starts a span.
+// The span is not added to the context used for the operation:
+// statements in a transaction are traced under the transaction span,
+// but run with the context of their caller.
+func (h *Hook) BeforeQuery(ctx context.Context, ev dotpgx.QueryEvent) context.Context {
+	name := ev.Name
+	if name == "" {
+		name = ev.Op
+	}
+	if ev.Op == dotpgx.OpBegin {
+		name = TxSpanName
+	}
+	attrs := []Attribute{
+		{AttrSystem, "postgresql"},
+		{AttrOperation, ev.Op},
+	}
+	if ev.Name != "" {
+		attrs = append(attrs, Attribute{AttrQuery, ev.Name})
+		if qi, err := h.db.Describe(ev.Name); err == nil && qi.File != "" {
+			attrs = append(attrs, Attribute{AttrFile, qi.File}, Attribute{AttrLine, qi.Line})
+		}
+	}
+	if ev.SQL != "" {
+		attrs = append(attrs, Attribute{AttrStatement, ev.SQL})
+	}
+	if len(ev.Queued) > 0 {
+		attrs = append(attrs, Attribute{AttrQueued, ev.Queued})
+	}
+	// For OpBegin, ev.Tx is the parent of a nested transaction
+	sctx, span := h.tracer.Start(h.parent(ctx, ev.Tx), name, attrs...)
+	ts := txSpan{ctx: sctx, span: span}
+	if ev.Op == dotpgx.OpBegin {
+		ts.parent = ev.Tx
+	}
+	return context.WithValue(ctx, spanKey{}, ts)
+}
+
+// AfterQuery implements dotpgx.Hook, it ends the span.
+// The span of a transaction is kept open until commit or rollback.
+func (h *Hook) AfterQuery(ctx context.Context, ev dotpgx.QueryEvent, err error) {
+	ts, ok := ctx.Value(spanKey{}).(txSpan)
+	if !ok {
+		return
+	}
+	if ev.Op == dotpgx.OpExec {
+		ts.span.SetAttributes(Attribute{AttrRowsAffected, ev.RowsAffected})
+	}
+	if err != nil {
+		setError(ts.span, err)
+	}
+	switch {
+	case ev.Op == dotpgx.OpBegin && err == nil:
+		h.mu.Lock()
+		h.txs[ev.Tx] = ts
+		h.mu.Unlock()
+		return
+	case ev.Op == dotpgx.OpCommit || ev.Op == dotpgx.OpRollback:
+		ts.span.End()
+		if err != dotpgx.ErrOpenNested {
+			h.endTx(ev.Tx, err)
+		}
+		return
+	}
+	ts.span.End()
+}
+
+// endTx ends the span of tx and of the transactions nested in it.
+func (h *Hook) endTx(tx *dotpgx.Tx, err error) {
+	h.mu.Lock()
+	ts, ok := h.txs[tx]
+	delete(h.txs, tx)
+	nested := h.nested(tx)
+	h.mu.Unlock()
+	for _, n := range nested {
+		n.span.End()
+	}
+	if !ok {
+		return
+	}
+	if err != nil {
+		setError(ts.span, err)
+	}
+	ts.span.End()
+}
+
+// nested removes the open transactions nested in tx and returns their spans,
+// innermost first. The lock must be held.
+func (h *Hook) nested(tx *dotpgx.Tx) []txSpan {
+	var spans []txSpan
+	for ntx, ts := range h.txs {
+		if ts.parent == tx {
+			delete(h.txs, ntx)
+			spans = append(spans, h.nested(ntx)...)
+			spans = append(spans, ts)
+		}
+	}
+	return spans
+}
+
+// setError marks span as failed, with the SQLSTATE of PostgreSQL errors.
+func setError(span Span, err error) {
+	if code := dotpgx.SQLState(err); code != "" {
+		span.SetAttributes(Attribute{AttrSQLState, code})
+	}
+	span.SetError(err)
+}
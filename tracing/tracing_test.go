@@ -0,0 +1,138 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx"
+	"github.com/usrpro/dotpgx"
+)
+
+func TestHook(t *testing.T) {
+	db := &dotpgx.DB{}
+	if err := db.ParseSQL(strings.NewReader("-- name: one\nselect 1;")); err != nil {
+		t.Fatal(err)
+	}
+	rec := NewRecorder()
+	h := New(db, rec)
+	if len(db.Hooks) != 1 || db.Hooks[0] != h {
+		t.Fatal("Hook not added to db")
+	}
+	root, _ := rec.Start(context.Background(), "caller")
+	tx := new(dotpgx.Tx)
+
+	run := func(ev dotpgx.QueryEvent, err error) {
+		ctx := h.BeforeQuery(root, ev)
+		h.AfterQuery(ctx, ev, err)
+	}
+	begin := dotpgx.QueryEvent{Op: dotpgx.OpBegin}
+	ctx := h.BeforeQuery(root, begin)
+	begin.Tx = tx
+	h.AfterQuery(ctx, begin, nil)
+	run(dotpgx.QueryEvent{Op: dotpgx.OpExec, Name: "one", SQL: "select 1;", Tx: tx, RowsAffected: 1}, nil)
+	run(dotpgx.QueryEvent{Op: dotpgx.OpQuery, Name: "one", SQL: "select 1;", Tx: tx}, pgx.PgError{Code: "42P01"})
+	run(dotpgx.QueryEvent{Op: dotpgx.OpCommit, Tx: tx}, dotpgx.ErrOpenNested)
+	run(dotpgx.QueryEvent{Op: dotpgx.OpRollback, Tx: tx}, nil)
+	run(dotpgx.QueryEvent{Op: dotpgx.OpExec, Name: "one", SQL: "select 1;"}, nil)
+
+	spans := rec.Spans()
+	var got []string
+	for _, s := range spans[1:] {
+		if !s.Ended && s.Name != TxSpanName {
+			t.Error("Span not ended:", s.Name)
+		}
+		got = append(got, s.Name+" < "+s.Parent.Name)
+	}
+	exp := []string{
+		"transaction < caller",
+		"one < transaction",
+		"one < transaction",
+		"commit < transaction",
+		"rollback < transaction",
+		"one < caller",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(exp) {
+		t.Fatal("Expected:", exp, "Got:", got)
+	}
+	if !spans[1].Ended {
+		t.Error("Transaction span not ended on rollback")
+	}
+	exec := spans[2].Attributes
+	if exec[AttrStatement] != "select 1;" || exec[AttrRowsAffected] != int64(1) || exec[AttrQuery] != "one" {
+		t.Error("Wrong exec attributes:", exec)
+	}
+	if spans[3].Attributes[AttrSQLState] != "42P01" || spans[3].Err == nil {
+		t.Error("Error not recorded:", spans[3].Attributes, spans[3].Err)
+	}
+	if len(h.txs) != 0 {
+		t.Error("Transaction span not removed")
+	}
+
+	// Rollback ends the spans of open nested transactions
+	beginTx := func(parent *dotpgx.Tx) *dotpgx.Tx {
+		ntx := new(dotpgx.Tx)
+		ev := dotpgx.QueryEvent{Op: dotpgx.OpBegin, Tx: parent}
+		ctx := h.BeforeQuery(root, ev)
+		ev.Tx = ntx
+		h.AfterQuery(ctx, ev, nil)
+		return ntx
+	}
+	outer := beginTx(nil)
+	n1 := beginTx(outer)
+	beginTx(n1)
+	other := beginTx(nil)
+	run(dotpgx.QueryEvent{Op: dotpgx.OpRollback, Tx: outer}, nil)
+	if len(h.txs) != 1 || h.txs[other].span == nil {
+		t.Error("Expected only the other transaction to be open, got:", h.txs)
+	}
+	open := 0
+	for _, s := range rec.Spans()[len(spans):] {
+		if !s.Ended {
+			open++
+		}
+	}
+	if open != 1 {
+		t.Error("Expected 1 open span, got:", open)
+	}
+}
+
+func TestHookDB(t *testing.T) {
+	db, err := dotpgx.New(dotpgx.Default.ConnPoolConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rec := NewRecorder()
+	New(db, rec)
+	if err = db.ParsePath("../tests/queries"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, root := rec.Start(context.Background(), "caller")
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := tx.QueryContext(ctx, "find-peers-by-email", "foo@bar.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	spans := rec.Spans()
+	if len(spans) != 4 {
+		t.Fatal("Expected 4 spans, got:", len(spans))
+	}
+	query := spans[2]
+	if query.Name != "find-peers-by-email" || query.Parent != spans[1] || spans[1].Parent != spans[0] {
+		t.Error("Wrong span tree")
+	}
+	if f, _ := query.Attributes[AttrFile].(string); !strings.HasSuffix(f, ".sql") {
+		t.Error("Missing source file:", query.Attributes)
+	}
+}
@@ -1,76 +1,288 @@
 package dotpgx
 
 import (
+	"context"
+	"strconv"
+
 	"github.com/jackc/pgx"
 )
 
-// Tx is transaction
+// Tx is transaction.
+// A Tx created by Tx.Begin is a nested transaction, backed by a savepoint.
 type Tx struct {
 	Ptx *pgx.Tx
-	qm  queryMap
+	reg *registry
+
+	hooks    []Hook
+	log      Logger
+	mode     PrepareMode
+	gen      int                               // Registry generation at begin
+	prepared map[string]*pgx.PreparedStatement // Prepared on the connection of the transaction
+
+	parent    *Tx
+	savepoint string // Empty for the outer transaction
+	seq       int    // Savepoint name counter, only used on the outer transaction
+	nested    []*Tx  // Open nested transactions
+	done      bool   // Nested transaction is committed, rolled back or closed by its parent
 }
 
 // Begin a transaction
 func (db *DB) Begin() (tx *Tx, err error) {
-	ptx, err := db.Pool.Begin()
+	return db.BeginContext(context.Background())
+}
+
+// BeginContext begins a transaction.
+// The context only affects the begin command,
+// it does not roll back the transaction when done.
+func (db *DB) BeginContext(ctx context.Context) (tx *Tx, err error) {
+	return db.BeginTx(ctx, nil)
+}
+
+// BeginTx begins a transaction with the isolation level,
+// access mode and deferrable mode from opts.
+// Nil opts uses the server defaults, like BeginContext.
+func (db *DB) BeginTx(ctx context.Context, opts *pgx.TxOptions) (tx *Tx, err error) {
+	ctx, h := startHooks(ctx, db.Hooks, QueryEvent{Op: OpBegin})
+	ptx, err := db.Pool.BeginEx(ctx, opts)
 	if err != nil {
+		h.end(err)
 		return
 	}
 	tx = &Tx{
-		Ptx: ptx,
-		qm:  db.qm,
+		Ptx:      ptx,
+		reg:      &db.reg,
+		hooks:    db.Hooks,
+		log:      db.log(),
+		mode:     db.PrepareMode,
+		gen:      db.reg.generation(),
+		prepared: make(map[string]*pgx.PreparedStatement),
 	}
+	h.endTx(tx, nil)
 	return
 }
 
+// Begin a nested transaction
+func (tx *Tx) Begin() (*Tx, error) {
+	return tx.BeginContext(context.Background())
+}
+
+// BeginContext begins a nested transaction, by creating a savepoint.
+// Commit of the nested transaction releases the savepoint,
+// rollback rolls back to the savepoint.
+// Nested transactions must be committed or rolled back before their parent is committed.
+// Rollback of the parent closes its open nested transactions.
+// Statements on a committed, rolled back or closed nested transaction return pgx.ErrTxClosed.
+func (tx *Tx) BeginContext(ctx context.Context) (*Tx, error) {
+	if tx.done {
+		return nil, pgx.ErrTxClosed
+	}
+	root := tx
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.seq++
+	sp := "dotpgx_sp_" + strconv.Itoa(root.seq)
+	ctx, h := startHooks(ctx, tx.hooks, QueryEvent{Op: OpBegin, SQL: "savepoint " + sp, Tx: tx})
+	if _, err := tx.Ptx.ExecEx(ctx, "savepoint "+sp, nil); err != nil {
+		h.end(err)
+		return nil, err
+	}
+	ntx := &Tx{
+		Ptx:       tx.Ptx,
+		reg:       tx.reg,
+		hooks:     tx.hooks,
+		log:       tx.log,
+		mode:      tx.mode,
+		gen:       tx.gen,
+		prepared:  tx.prepared,
+		parent:    tx,
+		savepoint: sp,
+	}
+	tx.nested = append(tx.nested, ntx)
+	h.endTx(ntx, nil)
+	return ntx, nil
+}
+
+// end marks a nested transaction as done and removes it from its parent.
+func (tx *Tx) end() {
+	tx.closeNested()
+	tx.done = true
+	p := tx.parent
+	for i, n := range p.nested {
+		if n == tx {
+			p.nested = append(p.nested[:i], p.nested[i+1:]...)
+			break
+		}
+	}
+}
+
+// closeNested marks the open nested transactions of tx as done,
+// as their savepoints no longer exist.
+func (tx *Tx) closeNested() {
+	for _, n := range tx.nested {
+		n.closeNested()
+		n.done = true
+	}
+	tx.nested = nil
+}
+
 // Rollback the transaction
 func (tx *Tx) Rollback() error {
-	return tx.Ptx.Rollback()
+	return tx.RollbackContext(context.Background())
+}
+
+// RollbackContext rolls back the transaction.
+// For a nested transaction, all changes since its savepoint are rolled back
+// and the savepoint is released.
+// Open nested transactions are closed: their Commit, Rollback and Begin return pgx.ErrTxClosed.
+// The context can be used to cancel the rollback command.
+func (tx *Tx) RollbackContext(ctx context.Context) (err error) {
+	ctx, h := tx.hook(ctx, OpRollback, "", nil)
+	defer func() { h.end(err) }()
+	return tx.rollback(ctx)
+}
+
+func (tx *Tx) rollback(ctx context.Context) error {
+	if tx.savepoint == "" {
+		tx.closeNested()
+		return tx.Ptx.RollbackEx(ctx)
+	}
+	if tx.done {
+		return pgx.ErrTxClosed
+	}
+	if _, err := tx.Ptx.ExecEx(ctx, "rollback to savepoint "+tx.savepoint, nil); err != nil {
+		return err
+	}
+	tx.end()
+	_, err := tx.Ptx.ExecEx(ctx, "release savepoint "+tx.savepoint, nil)
+	return err
 }
 
 // Commit the transaction
 func (tx *Tx) Commit() error {
-	return tx.Ptx.Commit()
+	return tx.CommitContext(context.Background())
+}
+
+// CommitContext commits the transaction.
+// For a nested transaction, the savepoint is released.
+// ErrOpenNested is returned if nested transactions are still open,
+// in which case the transaction stays open.
+// The context can be used to cancel the commit command.
+func (tx *Tx) CommitContext(ctx context.Context) (err error) {
+	ctx, h := tx.hook(ctx, OpCommit, "", nil)
+	defer func() { h.end(err) }()
+	return tx.commit(ctx)
+}
+
+func (tx *Tx) commit(ctx context.Context) error {
+	if len(tx.nested) > 0 {
+		return ErrOpenNested
+	}
+	if tx.savepoint == "" {
+		return tx.Ptx.CommitEx(ctx)
+	}
+	if tx.done {
+		return pgx.ErrTxClosed
+	}
+	if _, err := tx.Ptx.ExecEx(ctx, "release savepoint "+tx.savepoint, nil); err != nil {
+		return err
+	}
+	tx.end()
+	return nil
 }
 
 // Prepare a sql statement identified by name.
 func (tx *Tx) Prepare(name string) (*pgx.PreparedStatement, error) {
-	q, err := tx.qm.getQuery(name)
+	return tx.PrepareContext(context.Background(), name)
+}
+
+// PrepareContext prepares a sql statement identified by name,
+// on the connection of the transaction only.
+// The statement is not named after the query, as the pool may prepare the query
+// on the same connection later on. It stays prepared on the connection
+// after the transaction ends and is reused by later transactions on the connection.
+// The context can be used to cancel the prepare operation.
+func (tx *Tx) PrepareContext(ctx context.Context, name string) (*pgx.PreparedStatement, error) {
+	if tx.done {
+		return nil, pgx.ErrTxClosed
+	}
+	q, err := tx.reg.getQuery(name)
 	if err != nil {
 		return nil, err
 	}
-	q.ps, err = tx.Ptx.Prepare(name, q.getSQL())
+	ctx, h := tx.hook(ctx, OpPrepare, name, nil)
+	ps, err := tx.Ptx.PrepareEx(ctx, txStatement(name, q.sql), q.sql, nil)
 	if err != nil {
+		err = q.wrap(name, err)
+		if tx.log != nil {
+			tx.log.Error("Prepare failed", "query", name, "error", err)
+		}
+		h.end(err)
 		return nil, err
 	}
-	return q.ps, nil
+	h.end(nil)
+	tx.prepared[name] = ps
+	return ps, nil
 }
 
 // Query runs the sql indentified by name. Return a row set.
 func (tx *Tx) Query(name string, args ...interface{}) (*pgx.Rows, error) {
-	q, err := tx.qm.getQuery(name)
+	return tx.QueryContext(context.Background(), name, args...)
+}
+
+// QueryContext runs the sql indentified by name. Return a row set.
+// The query is cancelled when the context is done.
+// Errors reported by PostgreSQL are wrapped in a *QueryError.
+func (tx *Tx) QueryContext(ctx context.Context, name string, args ...interface{}) (*pgx.Rows, error) {
+	sql, err := tx.sql(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	return tx.Ptx.Query(q.getSQL(), args...)
+	ctx, h := tx.hook(ctx, OpQuery, name, args)
+	rows, err := tx.Ptx.QueryEx(ctx, sql, nil, args...)
+	err = tx.reg.wrap(name, err)
+	h.end(err)
+	return rows, err
 }
 
 // QueryRow runs the sql identified by name. It returns a single row.
 // Not that an error is only returned if the query is not defined.
 // A query error is defered untill row.Scan is run. See pgx docs for more info.
 func (tx *Tx) QueryRow(name string, args ...interface{}) (*pgx.Row, error) {
-	q, err := tx.qm.getQuery(name)
+	return tx.QueryRowContext(context.Background(), name, args...)
+}
+
+// QueryRowContext runs the sql identified by name. It returns a single row.
+// The query is cancelled when the context is done,
+// in which case the error is reported by row.Scan.
+// Hooks only receive the errors of sending the query, see Hook.
+func (tx *Tx) QueryRowContext(ctx context.Context, name string, args ...interface{}) (*pgx.Row, error) {
+	sql, err := tx.sql(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	return tx.Ptx.QueryRow(q.getSQL(), args...), nil
+	ctx, h := tx.hook(ctx, OpQueryRow, name, args)
+	row := tx.Ptx.QueryRowEx(ctx, sql, nil, args...)
+	h.end(tx.reg.wrap(name, (*pgx.Rows)(row).Err()))
+	return row, nil
 }
 
 // Exec runs the sql identified by name. Returns the result of the exec or an error.
 func (tx *Tx) Exec(name string, args ...interface{}) (pgx.CommandTag, error) {
-	q, err := tx.qm.getQuery(name)
+	return tx.ExecContext(context.Background(), name, args...)
+}
+
+// ExecContext runs the sql identified by name. Returns the result of the exec or an error.
+// The query is cancelled when the context is done.
+// Errors reported by PostgreSQL are wrapped in a *QueryError.
+func (tx *Tx) ExecContext(ctx context.Context, name string, args ...interface{}) (pgx.CommandTag, error) {
+	sql, err := tx.sql(ctx, name)
 	if err != nil {
 		return "", err
 	}
-	return tx.Ptx.Exec(q.getSQL(), args...)
+	ctx, h := tx.hook(ctx, OpExec, name, args)
+	tag, err := tx.Ptx.ExecEx(ctx, sql, nil, args...)
+	err = tx.reg.wrap(name, err)
+	h.endExec(tag, err)
+	return tag, err
 }
@@ -1,7 +1,10 @@
 package dotpgx
 
 import (
+	"context"
 	"testing"
+
+	"github.com/jackc/pgx"
 )
 
 var tx *Tx
@@ -103,10 +106,13 @@ func TestTxPrepare(t *testing.T) {
 	if _, err := tx.Prepare(name); err != nil {
 		t.Fatal("Error in prepare statement", err)
 	}
-	// Check if the query are indeed prepared
-	if !db.qm[name].isPrepared() {
+	// Check if the query is prepared on the transaction only
+	if tx.prepared[name] == nil {
 		t.Fatal("Query not prepared:", name)
 	}
+	if db.reg.prepared(db.reg.queries()[name]) {
+		t.Fatal("Query prepared on the pool:", name)
+	}
 
 	t.Run("Prepared TX query", TestTxQuery)
 	// Re-parse to test auto-clear
@@ -115,3 +121,164 @@ func TestTxPrepare(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestTxContext(t *testing.T) {
+	ctx := context.Background()
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.PrepareContext(ctx, "find-one-peer-by-email"); err != nil {
+		t.Fatal(err)
+	}
+	testCancel(t, func(ctx context.Context) error {
+		_, err := tx.ExecContext(ctx, "sleep", 10)
+		return err
+	})
+	// A cancelled query leaves the transaction unusable
+	if err := tx.CommitContext(ctx); err == nil {
+		t.Fatal("Expected commit error after cancelled query")
+	}
+	if err := tx.RollbackContext(ctx); err != nil && err != pgx.ErrTxClosed {
+		t.Fatal(err)
+	}
+	// Re-parse to reset the prepared statement of the transaction
+	if err := db.ParsePath(queriesDir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxNested(t *testing.T) {
+	const email = "nested@example.com"
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	count := func() int {
+		rows, err := tx.Query("find-peers-by-email", email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := rowScan(rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(got)
+	}
+
+	// Committed nested transaction
+	n1, err := tx.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = n1.Exec("create-peer", "Nested one", email); err != nil {
+		t.Fatal(err)
+	}
+	// Rolled back transaction nested in n1
+	n2, err := n1.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n1.savepoint == n2.savepoint {
+		t.Fatal("Savepoint names not unique:", n1.savepoint)
+	}
+	if _, err = n2.Exec("create-peer", "Nested two", email); err != nil {
+		t.Fatal(err)
+	}
+	if err = n1.Commit(); err != ErrOpenNested {
+		t.Fatal("Expected:", ErrOpenNested, "Got:", err)
+	}
+	if err = tx.Commit(); err != ErrOpenNested {
+		t.Fatal("Expected:", ErrOpenNested, "Got:", err)
+	}
+	if err = n2.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err = n2.Rollback(); err != pgx.ErrTxClosed {
+		t.Fatal("Expected:", pgx.ErrTxClosed, "Got:", err)
+	}
+	if n := count(); n != 1 {
+		t.Fatal("Expected 1 peer, got:", n)
+	}
+	if err = n1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = n1.Begin(); err != pgx.ErrTxClosed {
+		t.Fatal("Expected:", pgx.ErrTxClosed, "Got:", err)
+	}
+
+	// Rollback after a failed statement restores the transaction
+	n3, err := tx.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = n3.Exec("sleep", "not a number"); err == nil {
+		t.Fatal("Expected error")
+	}
+	if err = n3.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Fatal("Expected 1 peer, got:", n)
+	}
+
+	// Rollback closes the open nested transactions
+	n4, err := tx.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n5, err := n4.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = n4.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err = n5.Commit(); err != pgx.ErrTxClosed {
+		t.Fatal("Expected:", pgx.ErrTxClosed, "Got:", err)
+	}
+	// Statements do not run on the parent of a closed nested transaction
+	for _, ntx := range []*Tx{n1, n4, n5} {
+		if _, err = ntx.Exec("create-peer", "Closed", email); err != pgx.ErrTxClosed {
+			t.Fatal("Expected:", pgx.ErrTxClosed, "Got:", err)
+		}
+		if _, err = ntx.Query("find-peers-by-email", email); err != pgx.ErrTxClosed {
+			t.Fatal("Expected:", pgx.ErrTxClosed, "Got:", err)
+		}
+		if _, err = ntx.QueryRow("find-peers-by-email", email); err != pgx.ErrTxClosed {
+			t.Fatal("Expected:", pgx.ErrTxClosed, "Got:", err)
+		}
+		if _, err = ntx.Prepare("find-peers-by-email"); err != pgx.ErrTxClosed {
+			t.Fatal("Expected:", pgx.ErrTxClosed, "Got:", err)
+		}
+	}
+	n6, err := tx.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leave the peer out of the other tests
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err = n6.Rollback(); err != pgx.ErrTxClosed {
+		t.Fatal("Expected:", pgx.ErrTxClosed, "Got:", err)
+	}
+}
+
+func TestTxClosed(t *testing.T) {
+	tx := &Tx{reg: new(registry), done: true}
+	ctx := context.Background()
+	if _, err := tx.QueryContext(ctx, "one"); err != pgx.ErrTxClosed {
+		t.Error("Expected:", pgx.ErrTxClosed, "Got:", err)
+	}
+	if _, err := tx.QueryRowContext(ctx, "one"); err != pgx.ErrTxClosed {
+		t.Error("Expected:", pgx.ErrTxClosed, "Got:", err)
+	}
+	if _, err := tx.ExecContext(ctx, "one"); err != pgx.ErrTxClosed {
+		t.Error("Expected:", pgx.ErrTxClosed, "Got:", err)
+	}
+	if _, err := tx.PrepareContext(ctx, "one"); err != pgx.ErrTxClosed {
+		t.Error("Expected:", pgx.ErrTxClosed, "Got:", err)
+	}
+}
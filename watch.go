@@ -0,0 +1,196 @@
+package dotpgx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultWatchInterval is the polling interval of Watch,
+// if DB.WatchInterval is not set.
+const DefaultWatchInterval = time.Second
+
+// fileState is used to detect changes of a watched file.
+type fileState struct {
+	mod  time.Time
+	size int64
+}
+
+// watchFiles returns the state of the files in paths.
+// Paths can be files or directories, of which the files with a .sql suffix are used, like ParsePath.
+func watchFiles(paths []string) (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		names := []string{p}
+		if fi.IsDir() {
+			if names, err = filepath.Glob(p + "/*.sql"); err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range names {
+			if fi, err = os.Stat(name); err != nil {
+				return nil, err
+			}
+			files[name] = fileState{fi.ModTime(), fi.Size()}
+		}
+	}
+	return files, nil
+}
+
+/*
+Watch polls the files in paths for changes, until the context is done.
+Paths can be files or directories, of which the files with a .sql suffix are watched.
+The files are expected to be parsed already, for instance by InitDB with the same path.
+Watch returns after the initial scan of paths, polling continues in the background.
+
+A changed or new file is parsed again and its queries replace the ones previously
+parsed from the same file, in a single swap of the query map.
+Queries that disappeared from the file are dropped,
+as are the queries of removed files.
+Replaced queries that were prepared get prepared again,
+in PrepareEager mode all queries of the file get prepared.
+Unnamed queries of a changed file get new numbers.
+
+Errors of parsing and preparing are reported to db.OnWatchError, if set.
+A file that fails to parse keeps its previously parsed queries.
+
+Watch is meant for development. Statements prepared inside a transaction are not updated.
+*/
+func (db *DB) Watch(ctx context.Context, paths ...string) error {
+	files, err := watchFiles(paths)
+	if err != nil {
+		return err
+	}
+	interval := db.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				files = db.poll(ctx, paths, files)
+			}
+		}
+	}()
+	return nil
+}
+
+// poll reloads the files which changed since the previous state.
+// It returns the new state.
+func (db *DB) poll(ctx context.Context, paths []string, prev map[string]fileState) map[string]fileState {
+	cur, err := watchFiles(paths)
+	if err != nil {
+		db.watchError(err)
+		return prev
+	}
+	var changed []string
+	for name, st := range cur {
+		if prev[name] != st {
+			changed = append(changed, name)
+		}
+	}
+	for name := range prev {
+		if _, ok := cur[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	for _, name := range changed {
+		if _, ok := cur[name]; !ok {
+			err = db.reload(ctx, name, false)
+		} else {
+			err = db.reload(ctx, name, true)
+		}
+		if err != nil {
+			// The file is retried on its next change
+			db.watchError(err)
+			continue
+		}
+		db.log().Debug("Reloaded sql", "file", name)
+	}
+	return cur
+}
+
+func (db *DB) watchError(err error) {
+	if db.OnWatchError != nil {
+		db.OnWatchError(err)
+		return
+	}
+	db.log().Error("Reloading sql failed", "error", err)
+}
+
+// reload replaces the queries parsed from file.
+// If exists is false, the queries of the file are only dropped.
+// Files are compared by their cleaned path.
+func (db *DB) reload(ctx context.Context, file string, exists bool) error {
+	old := make(queryMap)
+	var current queryMap
+	clean := filepath.Clean(file)
+	db.reg.stmts.Lock()
+	err := db.reg.update(func(qm queryMap, qn int) (queryMap, int, error) {
+		nqm := make(queryMap, len(qm))
+		for name, q := range qm {
+			if filepath.Clean(q.start.File) == clean {
+				old[name] = q
+			} else {
+				nqm[name] = q
+			}
+		}
+		if exists {
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, qn, err
+			}
+			parsed, n, err := db.parse(f, file, nqm, qn)
+			f.Close()
+			if err != nil {
+				return nil, qn, err
+			}
+			qn = n
+			nqm = merge(nqm, parsed)
+		}
+		current = nqm
+		return nqm, qn, nil
+	})
+	if err != nil {
+		db.reg.stmts.Unlock()
+		return err
+	}
+
+	var (
+		errs  MultiError
+		names []string
+	)
+	for name, q := range old {
+		if db.reg.prepared(q) && current[name] != nil && db.PrepareMode != PrepareEager {
+			names = append(names, name)
+		}
+	}
+	if err = db.deallocate(old); err != nil {
+		errs = append(errs, err)
+	}
+	db.reg.stmts.Unlock()
+	if db.PrepareMode == PrepareEager && db.Pool != nil {
+		for name, q := range current {
+			if filepath.Clean(q.start.File) == clean {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	if err := db.prepareNames(ctx, names); err != nil {
+		errs = append(errs, err)
+	}
+	return errs.err()
+}
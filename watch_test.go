@@ -0,0 +1,129 @@
+package dotpgx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeSQL(t *testing.T, name, sql string, mod time.Time) {
+	if err := os.WriteFile(name, []byte(sql), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.sql"), filepath.Join(dir, "b.sql")
+	mod := time.Now().Add(-time.Hour)
+	writeSQL(t, a, "-- name: one\nselect 1;\n-- name: two\nselect 2;", mod)
+
+	cdb := new(DB)
+	if err := cdb.ParsePath(dir); err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	cdb.OnWatchError = func(err error) { errs = append(errs, err) }
+	ctx := context.Background()
+	files, err := watchFiles([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changed and new files
+	mod = mod.Add(time.Minute)
+	writeSQL(t, a, "-- name: one\nselect 11;\n-- name: three\nselect 3;", mod)
+	writeSQL(t, b, "-- name: four\nselect 4;", mod)
+	files = cdb.poll(ctx, []string{dir}, files)
+	if exp := []string{"four", "one", "three"}; !reflect.DeepEqual(exp, cdb.List()) {
+		t.Fatal("\nExpected:\n", exp, "\nGot:\n", cdb.List())
+	}
+	if q, _ := cdb.Describe("one"); q.SQL != "select 11;" {
+		t.Fatal("Query not reloaded:", q.SQL)
+	}
+
+	// Parse errors keep the previous queries
+	mod = mod.Add(time.Minute)
+	writeSQL(t, a, "-- name: one\nselect 'unterminated;", mod)
+	writeSQL(t, b, "-- name: one\nselect 1;", mod)
+	files = cdb.poll(ctx, []string{dir}, files)
+	if len(errs) != 2 {
+		t.Fatal("Expected 2 errors, got:", errs)
+	}
+	if _, ok := errs[0].(*ParseError); !ok {
+		t.Error("Expected *ParseError, got:", errs[0])
+	}
+	if _, ok := errs[1].(*DuplicateError); !ok {
+		t.Error("Expected *DuplicateError, got:", errs[1])
+	}
+	if exp := []string{"four", "one", "three"}; !reflect.DeepEqual(exp, cdb.List()) {
+		t.Fatal("\nExpected:\n", exp, "\nGot:\n", cdb.List())
+	}
+
+	// Unchanged files are not parsed again
+	errs = nil
+	files = cdb.poll(ctx, []string{dir}, files)
+	if len(errs) != 0 {
+		t.Fatal("Unexpected errors:", errs)
+	}
+
+	// Removed files
+	if err = os.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	cdb.poll(ctx, []string{dir}, files)
+	if exp := []string{"one", "three"}; !reflect.DeepEqual(exp, cdb.List()) {
+		t.Fatal("\nExpected:\n", exp, "\nGot:\n", cdb.List())
+	}
+
+	if err = cdb.Watch(ctx, filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("Expected error for missing path")
+	}
+}
+
+func TestWatchPoll(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.sql")
+	writeSQL(t, a, "-- name: one\nselect 1;", time.Now().Add(-time.Hour))
+	cdb := &DB{WatchInterval: 10 * time.Millisecond}
+	if err := cdb.ParseFiles(a); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := cdb.Watch(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	writeSQL(t, a, "-- name: two\nselect 2;", time.Now())
+	for i := 0; i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if cdb.HasQueries() && cdb.List()[0] == "two" {
+			return
+		}
+	}
+	t.Fatal("File not reloaded:", cdb.List())
+}
+
+func TestWatchCleanPath(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.sql")
+	writeSQL(t, a, "-- name: one\nselect 1;", time.Now().Add(-time.Hour))
+	cdb := new(DB)
+	// Parsed and watched through different paths of the same file
+	if err := cdb.ParseFiles(dir + "/./a.sql"); err != nil {
+		t.Fatal(err)
+	}
+	writeSQL(t, a, "-- name: one\nselect 11;", time.Now())
+	if err := cdb.reload(context.Background(), a, true); err != nil {
+		t.Fatal(err)
+	}
+	if q, _ := cdb.Describe("one"); q.SQL != "select 11;" {
+		t.Fatal("Query not reloaded:", q.SQL)
+	}
+}